@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/NearlyUnique/awsqueue/queue"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+const (
+	archiveManifestName = "manifest.json"
+	archiveBodySuffix   = ".body"
+	archiveAttrSuffix   = ".attributes.json"
+)
+
+type (
+	archiveManifest struct {
+		Queue        string                 `json:"queueUrl"`
+		Archived     string                 `json:"archived"`
+		QueueAttrs   map[string]flexiString `json:"queueAttributes"`
+		MessageCount int                    `json:"messageCount"`
+		Messages     []archiveEntry         `json:"messages"`
+	}
+	archiveEntry struct {
+		MessageId string `json:"messageId"`
+		MD5OfBody string `json:"md5OfBody"`
+	}
+	// archivedAttributes is the sidecar written next to each message body
+	archivedAttributes struct {
+		MessageId  string                                `json:"messageId"`
+		AwsAttrib  map[string]string                     `json:"awsAttributes"`
+		CustAttrib map[string]*sqs.MessageAttributeValue `json:"customAttributes"`
+	}
+	archiveWriter struct {
+		dir      string
+		manifest archiveManifest
+		// written is every MessageId already archived, a message received twice is only written once
+		written map[string]bool
+	}
+	restoreOptions struct {
+		svc      *sqs.SQS
+		queueURL string
+		dir      string
+		ctx      context.Context
+	}
+)
+
+func newArchiveWriter(dir, queueURL string, queueAttrs map[string]flexiString, loc *time.Location) (*archiveWriter, error) {
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return nil, err
+	}
+	return &archiveWriter{
+		dir:     dir,
+		written: make(map[string]bool),
+		manifest: archiveManifest{
+			Queue:      queueURL,
+			Archived:   queue.FormatTime(time.Now().UTC(), loc),
+			QueueAttrs: queueAttrs,
+		},
+	}, nil
+}
+
+func (a *archiveWriter) add(messages []message) {
+	for _, m := range messages {
+		if err := a.addOne(m); err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "ERROR:archiving %s %v\n", m.MessageId, err)
+		}
+	}
+}
+
+func (a *archiveWriter) addOne(m message) error {
+	if m.Raw == nil || m.MessageId == "" {
+		return errors.New("message has no id")
+	}
+	if a.written[m.MessageId] {
+		return nil
+	}
+	err := ioutil.WriteFile(a.path(m.MessageId+archiveBodySuffix), []byte(aws.StringValue(m.Raw.Body)), 0666)
+	if err != nil {
+		return err
+	}
+	buf, err := jsonMarshal(archivedAttributes{
+		MessageId:  m.MessageId,
+		AwsAttrib:  m.AwsAttrib,
+		CustAttrib: m.Raw.MessageAttributes,
+	})
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(a.path(m.MessageId+archiveAttrSuffix), buf, 0666)
+	if err != nil {
+		return err
+	}
+	a.manifest.Messages = append(a.manifest.Messages, archiveEntry{MessageId: m.MessageId, MD5OfBody: m.MD5OfBody})
+	a.manifest.MessageCount++
+	a.written[m.MessageId] = true
+	return nil
+}
+
+// close writes the manifest, messages written without it cannot be restored
+func (a *archiveWriter) close() error {
+	buf, err := jsonMarshal(a.manifest)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(a.path(archiveManifestName), buf, 0666)
+}
+
+func (a *archiveWriter) path(name string) string {
+	return filepath.Join(a.dir, name)
+}
+
+func readArchiveManifest(dir string) (archiveManifest, error) {
+	var manifest archiveManifest
+	buf, err := ioutil.ReadFile(filepath.Join(dir, archiveManifestName))
+	if err != nil {
+		return manifest, err
+	}
+	err = json.Unmarshal(buf, &manifest)
+	return manifest, err
+}
+
+// verifyArchive reports anything in the archive that does not agree with the manifest
+func verifyArchive(dir string, manifest archiveManifest) ([]string, error) {
+	var differences []string
+	if manifest.MessageCount != len(manifest.Messages) {
+		differences = append(differences,
+			fmt.Sprintf("manifest count %d does not match %d listed messages", manifest.MessageCount, len(manifest.Messages)))
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	bodies := 0
+	for _, f := range files {
+		if strings.HasSuffix(f.Name(), archiveBodySuffix) {
+			bodies++
+		}
+	}
+	if bodies != len(manifest.Messages) {
+		differences = append(differences,
+			fmt.Sprintf("archive holds %d message bodies, manifest lists %d", bodies, len(manifest.Messages)))
+	}
+	for _, entry := range manifest.Messages {
+		body, err := ioutil.ReadFile(filepath.Join(dir, entry.MessageId+archiveBodySuffix))
+		if err != nil {
+			differences = append(differences, fmt.Sprintf("%s: %v", entry.MessageId, err))
+			continue
+		}
+		if sum := md5Hex(body); sum != entry.MD5OfBody {
+			differences = append(differences,
+				fmt.Sprintf("%s: body md5 %s does not match manifest %s", entry.MessageId, sum, entry.MD5OfBody))
+		}
+	}
+	return differences, nil
+}
+
+func restoreArchive(options restoreOptions) error {
+	manifest, err := readArchiveManifest(options.dir)
+	if err != nil {
+		return fmt.Errorf("failed reading archive manifest: %v", err)
+	}
+	differences, err := verifyArchive(options.dir, manifest)
+	if err != nil {
+		return err
+	}
+	restored := 0
+	for _, entry := range manifest.Messages {
+		if options.ctx.Err() != nil {
+			break
+		}
+		diff, err := restoreMessage(options, entry)
+		if err != nil {
+			differences = append(differences, fmt.Sprintf("%s: %v", entry.MessageId, err))
+			continue
+		}
+		if diff != "" {
+			differences = append(differences, diff)
+		}
+		restored++
+	}
+	for _, d := range differences {
+		_, _ = fmt.Fprintln(os.Stderr, d)
+	}
+	_, _ = fmt.Fprintf(os.Stderr, "restored %d of %d messages from %s, %d differences\n",
+		restored, manifest.MessageCount, manifest.Queue, len(differences))
+	if restored != len(manifest.Messages) {
+		return errors.New("restore incomplete")
+	}
+	return nil
+}
+
+func restoreMessage(options restoreOptions, entry archiveEntry) (string, error) {
+	body, err := ioutil.ReadFile(filepath.Join(options.dir, entry.MessageId+archiveBodySuffix))
+	if err != nil {
+		return "", err
+	}
+	var attrs archivedAttributes
+	buf, err := ioutil.ReadFile(filepath.Join(options.dir, entry.MessageId+archiveAttrSuffix))
+	if err != nil {
+		return "", err
+	}
+	if err := json.Unmarshal(buf, &attrs); err != nil {
+		return "", err
+	}
+	input := sqs.SendMessageInput{
+		QueueUrl:          &options.queueURL,
+		MessageBody:       aws.String(string(body)),
+		MessageAttributes: attrs.CustAttrib,
+	}
+	if group, ok := attrs.AwsAttrib[sqs.MessageSystemAttributeNameMessageGroupId]; ok {
+		input.MessageGroupId = aws.String(group)
+		input.MessageDeduplicationId = aws.String(entry.MessageId)
+	}
+	out, err := options.svc.SendMessageWithContext(options.ctx, &input)
+	if err != nil {
+		return "", err
+	}
+	if sent := aws.StringValue(out.MD5OfMessageBody); sent != entry.MD5OfBody {
+		return fmt.Sprintf("%s: sent md5 %s does not match manifest %s", entry.MessageId, sent, entry.MD5OfBody), nil
+	}
+	return "", nil
+}
+
+func md5Hex(buf []byte) string {
+	sum := md5.Sum(buf)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/NearlyUnique/awsqueue/queue"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_an_archive_can_be_written_and_verified(t *testing.T) {
+	dir, err := ioutil.TempDir("", "awsqueue")
+	require.NoError(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	msgs := queue.SimplifyMessages(&sqs.ReceiveMessageOutput{
+		Messages: []*sqs.Message{
+			{MessageId: aws.String("id-1"), Body: aws.String("body1"), MD5OfBody: aws.String(md5Hex([]byte("body1")))},
+			{MessageId: aws.String("id-2"), Body: aws.String("body2"), MD5OfBody: aws.String(md5Hex([]byte("body2")))},
+		},
+	}, nil)
+	archive, err := newArchiveWriter(dir, "http://any.com/1", map[string]flexiString{queue.AttrKeyQueueName: "1"}, nil)
+	require.NoError(t, err)
+	archive.add(msgs)
+	// received again after the visibility timeout
+	archive.add(msgs[:1])
+	require.NoError(t, archive.close())
+
+	manifest, err := readArchiveManifest(dir)
+	require.NoError(t, err)
+	assert.Equal(t, 2, manifest.MessageCount)
+	assert.Equal(t, flexiString("1"), manifest.QueueAttrs[queue.AttrKeyQueueName])
+
+	t.Run("an untouched archive has no differences", func(t *testing.T) {
+		differences, err := verifyArchive(dir, manifest)
+
+		require.NoError(t, err)
+		assert.Empty(t, differences)
+	})
+	t.Run("a modified body is reported", func(t *testing.T) {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "id-2"+archiveBodySuffix), []byte("changed"), 0666))
+
+		differences, err := verifyArchive(dir, manifest)
+
+		require.NoError(t, err)
+		assert.Len(t, differences, 1)
+	})
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/NearlyUnique/awsqueue/queue"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+const (
+	SetKeyDeadLetterQueue = "dlq"
+	SetKeyMaxReceiveCount = "max-receive-count"
+)
+
+type (
+	// attrLimit is the SQS range for a numeric queue attribute
+	attrLimit struct {
+		name     string
+		min, max int64
+	}
+	redrivePolicy struct {
+		DeadLetterTargetArn string `json:"deadLetterTargetArn"`
+		MaxReceiveCount     int64  `json:"maxReceiveCount"`
+	}
+	setAttributesOptions struct {
+		svc         *sqs.SQS
+		queueURL    string
+		queueAttrs  map[string]flexiString
+		set         map[string]string
+		dryRun      bool
+		interaction interactionType
+		yes         bool
+		ctx         context.Context
+	}
+)
+
+// settableAttributes maps --set keys to the queue attribute and its limits
+var settableAttributes = map[string]attrLimit{
+	"visibility-timeout": {sqs.QueueAttributeNameVisibilityTimeout, 0, 43200},
+	"retention":          {sqs.QueueAttributeNameMessageRetentionPeriod, 60, 1209600},
+	"delay":              {sqs.QueueAttributeNameDelaySeconds, 0, 900},
+	"max-size":           {sqs.QueueAttributeNameMaximumMessageSize, 1024, 262144},
+	"wait-time":          {sqs.QueueAttributeNameReceiveMessageWaitTimeSeconds, 0, 20},
+}
+
+func setQueueAttributes(options setAttributesOptions) error {
+	changes, err := queueAttributeChanges(options.set, options.queueAttrs, func(name string) (string, error) {
+		return queueArnByName(options.ctx, options.svc, name)
+	})
+	if err != nil {
+		return err
+	}
+	if len(changes) == 0 {
+		return errors.New("no attributes to change")
+	}
+	after := make(map[string]flexiString)
+	for k, v := range options.queueAttrs {
+		after[k] = v
+	}
+	for k, v := range changes {
+		after[k] = flexiString(v)
+	}
+	fmt.Println(options.queueAttrs[queue.AttrKeyQueueName])
+	for _, line := range attributeDiff(options.queueAttrs, after) {
+		fmt.Println(line)
+	}
+	if options.dryRun {
+		return nil
+	}
+	ok, err := confirm("Set queue attributes?", options.interaction, options.yes)
+	if err != nil || !ok {
+		return err
+	}
+	input := sqs.SetQueueAttributesInput{
+		QueueUrl:   &options.queueURL,
+		Attributes: make(map[string]*string),
+	}
+	for k, v := range changes {
+		input.Attributes[k] = aws.String(v)
+	}
+	_, err = options.svc.SetQueueAttributesWithContext(options.ctx, &input)
+	return err
+}
+
+// queueAttributeChanges validates the --set values against SQS limits and returns the attributes to set
+func queueAttributeChanges(set map[string]string, current map[string]flexiString, dlqArn func(string) (string, error)) (map[string]string, error) {
+	changes := make(map[string]string)
+	for key, value := range set {
+		if key == SetKeyDeadLetterQueue || key == SetKeyMaxReceiveCount {
+			continue
+		}
+		limit, ok := settableAttributes[key]
+		if !ok {
+			return nil, fmt.Errorf("unknown attribute %q, use one of %s", key, strings.Join(settableKeys(), ", "))
+		}
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || n < limit.min || n > limit.max {
+			return nil, fmt.Errorf("%s must be between %d and %d", key, limit.min, limit.max)
+		}
+		changes[limit.name] = strconv.FormatInt(n, 10)
+	}
+
+	dlq, setDlq := set[SetKeyDeadLetterQueue]
+	count, setCount := set[SetKeyMaxReceiveCount]
+	if !setDlq && !setCount {
+		return changes, nil
+	}
+	if setDlq && (dlq == "" || dlq == "none") {
+		changes[sqs.QueueAttributeNameRedrivePolicy] = ""
+		return changes, nil
+	}
+	var policy redrivePolicy
+	if existing := current[sqs.QueueAttributeNameRedrivePolicy]; existing != "" {
+		if err := json.Unmarshal([]byte(existing), &policy); err != nil {
+			return nil, fmt.Errorf("failed reading current RedrivePolicy: %v", err)
+		}
+	}
+	if setDlq {
+		arn, err := dlqArn(dlq)
+		if err != nil {
+			return nil, fmt.Errorf("failed resolving dead letter queue %q: %v", dlq, err)
+		}
+		policy.DeadLetterTargetArn = arn
+	}
+	if setCount {
+		n, err := strconv.ParseInt(count, 10, 64)
+		if err != nil || n < 1 || n > 1000 {
+			return nil, fmt.Errorf("%s must be between 1 and 1000", SetKeyMaxReceiveCount)
+		}
+		policy.MaxReceiveCount = n
+	}
+	if policy.DeadLetterTargetArn == "" {
+		return nil, fmt.Errorf("%s requires %s as the queue has no dead letter queue", SetKeyMaxReceiveCount, SetKeyDeadLetterQueue)
+	}
+	if policy.MaxReceiveCount == 0 {
+		return nil, fmt.Errorf("%s requires %s as the queue has no redrive policy", SetKeyDeadLetterQueue, SetKeyMaxReceiveCount)
+	}
+	buf, err := json.Marshal(policy)
+	if err != nil {
+		return nil, err
+	}
+	changes[sqs.QueueAttributeNameRedrivePolicy] = string(buf)
+	return changes, nil
+}
+
+// attributeDiff lists the attributes that differ, in key order
+func attributeDiff(before, after map[string]flexiString) []string {
+	keys := make(map[string]bool)
+	for k := range before {
+		keys[k] = true
+	}
+	for k := range after {
+		keys[k] = true
+	}
+	var sorted []string
+	for k := range keys {
+		if before[k] != after[k] {
+			sorted = append(sorted, k)
+		}
+	}
+	sort.Strings(sorted)
+	var lines []string
+	for _, k := range sorted {
+		lines = append(lines, fmt.Sprintf("  %s: %q -> %q", k, before[k], after[k]))
+	}
+	return lines
+}
+
+func settableKeys() []string {
+	keys := []string{SetKeyDeadLetterQueue, SetKeyMaxReceiveCount}
+	for k := range settableAttributes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func queueArnByName(ctx context.Context, svc *sqs.SQS, name string) (string, error) {
+	url, err := svc.GetQueueUrlWithContext(ctx, &sqs.GetQueueUrlInput{QueueName: aws.String(name)})
+	if err != nil {
+		return "", err
+	}
+	attr, err := svc.GetQueueAttributesWithContext(ctx, &sqs.GetQueueAttributesInput{
+		QueueUrl:       url.QueueUrl,
+		AttributeNames: []*string{aws.String(sqs.QueueAttributeNameQueueArn)},
+	})
+	if err != nil {
+		return "", err
+	}
+	return aws.StringValue(attr.Attributes[sqs.QueueAttributeNameQueueArn]), nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_queue_attribute_changes(t *testing.T) {
+	noDlq := func(string) (string, error) { return "", errors.New("not expected") }
+	dlqArn := func(name string) (string, error) { return "arn:aws:sqs:eu-west-1:1:" + name, nil }
+
+	t.Run("values within limits are converted to attribute names", func(t *testing.T) {
+		changes, err := queueAttributeChanges(map[string]string{"visibility-timeout": "60", "wait-time": "20"}, nil, noDlq)
+
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{
+			sqs.QueueAttributeNameVisibilityTimeout:             "60",
+			sqs.QueueAttributeNameReceiveMessageWaitTimeSeconds: "20",
+		}, changes)
+	})
+	t.Run("values outside limits are rejected", func(t *testing.T) {
+		_, err := queueAttributeChanges(map[string]string{"wait-time": "21"}, nil, noDlq)
+
+		assert.Error(t, err)
+	})
+	t.Run("unknown keys are rejected", func(t *testing.T) {
+		_, err := queueAttributeChanges(map[string]string{"colour": "blue"}, nil, noDlq)
+
+		assert.Error(t, err)
+	})
+	t.Run("a dead letter queue is set by name", func(t *testing.T) {
+		changes, err := queueAttributeChanges(map[string]string{SetKeyDeadLetterQueue: "orders-dlq", SetKeyMaxReceiveCount: "5"}, nil, dlqArn)
+
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"deadLetterTargetArn":"arn:aws:sqs:eu-west-1:1:orders-dlq","maxReceiveCount":5}`,
+			changes[sqs.QueueAttributeNameRedrivePolicy])
+	})
+	t.Run("max receive count alone keeps the existing dead letter queue", func(t *testing.T) {
+		current := map[string]flexiString{
+			sqs.QueueAttributeNameRedrivePolicy: `{"deadLetterTargetArn":"arn:aws:sqs:eu-west-1:1:dlq","maxReceiveCount":3}`,
+		}
+		changes, err := queueAttributeChanges(map[string]string{SetKeyMaxReceiveCount: "10"}, current, noDlq)
+
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"deadLetterTargetArn":"arn:aws:sqs:eu-west-1:1:dlq","maxReceiveCount":10}`,
+			changes[sqs.QueueAttributeNameRedrivePolicy])
+	})
+	t.Run("a new dead letter queue needs a max receive count", func(t *testing.T) {
+		_, err := queueAttributeChanges(map[string]string{SetKeyDeadLetterQueue: "orders-dlq"}, nil, dlqArn)
+
+		assert.Error(t, err)
+	})
+}
+
+func Test_attribute_diff_only_lists_changes(t *testing.T) {
+	before := map[string]flexiString{"a": "1", "b": "2"}
+	after := map[string]flexiString{"a": "1", "b": "3", "c": "4"}
+
+	lines := attributeDiff(before, after)
+
+	assert.Equal(t, []string{`  b: "2" -> "3"`, `  c: "" -> "4"`}, lines)
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/NearlyUnique/awsqueue/queue"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/cloudwatch/cloudwatchiface"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+const (
+	ExitCodeError  = 1
+	ExitCodeBreach = 2
+
+	CheckStatusOK     = "OK"
+	CheckStatusBreach = "BREACH"
+	// CheckStatusNoQueue is a rule matching no queue, so a mistyped filter fails rather than passing
+	CheckStatusNoQueue = "NO_QUEUE"
+)
+
+type (
+	checkRule struct {
+		Filter      string `json:"filter"`
+		MaxMessages *int64 `json:"maxMessages,omitempty"`
+		MaxAge      string `json:"maxAge,omitempty"`
+	}
+	checkResult struct {
+		Status    string   `json:"status"`
+		Queue     string   `json:"queue"`
+		Rule      string   `json:"rule"`
+		Messages  int64    `json:"messages"`
+		OldestAge string   `json:"oldestAge,omitempty"`
+		Reasons   []string `json:"reasons,omitempty"`
+	}
+	checkOptions struct {
+		// metrics is where the age of the oldest message comes from, receiving would raise receive counts
+		metrics cloudwatchiface.CloudWatchAPI
+		rules   []checkRule
+		asJson  bool
+		out     io.Writer
+		ctx     context.Context
+	}
+	// exitCodeError lets an action choose the process exit code
+	exitCodeError struct {
+		code int
+		msg  string
+	}
+	oldestMessageFunc func(queueName string) (time.Duration, error)
+)
+
+func (e exitCodeError) Error() string {
+	return e.msg
+}
+
+func checkQueues(options checkOptions, result QueueSearchResult) error {
+	results, err := evaluateChecks(options.rules, result, func(queueName string) (time.Duration, error) {
+		return oldestMessageAge(options.ctx, options.metrics, queueName, time.Now())
+	})
+	if err != nil {
+		return err
+	}
+	if err := writeCheckReport(options.out, options.asJson, results); err != nil {
+		return err
+	}
+	breaches, unmatched := 0, 0
+	for _, r := range results {
+		switch r.Status {
+		case CheckStatusBreach:
+			breaches++
+		case CheckStatusNoQueue:
+			unmatched++
+		}
+	}
+	if breaches > 0 || unmatched > 0 {
+		return exitCodeError{code: ExitCodeBreach, msg: fmt.Sprintf("%d check(s) breached, %d rule(s) matched no queue", breaches, unmatched)}
+	}
+	return nil
+}
+
+func evaluateChecks(rules []checkRule, result QueueSearchResult, oldest oldestMessageFunc) ([]checkResult, error) {
+	var results []checkResult
+	for _, rule := range rules {
+		var maxAge time.Duration
+		if rule.MaxAge != "" {
+			var err error
+			if maxAge, err = time.ParseDuration(rule.MaxAge); err != nil {
+				return nil, fmt.Errorf("invalid maxAge %q: %v", rule.MaxAge, err)
+			}
+		}
+		matcher := QueueSearchResult{Filter: rule.Filter}
+		matched := false
+		for _, attr := range result.Attrs {
+			if !matcher.MatchesFilter(attr[queue.AttrKeyQueueName].String()) {
+				continue
+			}
+			matched = true
+			r := checkResult{
+				Status: CheckStatusOK,
+				Queue:  attr[queue.AttrKeyQueueName].String(),
+				Rule:   rule.String(),
+			}
+			count, err := strconv.ParseInt(attr[sqs.QueueAttributeNameApproximateNumberOfMessages].String(), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("no message count for %s", r.Queue)
+			}
+			r.Messages = count
+			if rule.MaxMessages != nil && count > *rule.MaxMessages {
+				r.Reasons = append(r.Reasons, fmt.Sprintf("messages %d > %d", count, *rule.MaxMessages))
+			}
+			if maxAge > 0 && count > 0 {
+				age, err := oldest(r.Queue)
+				if err != nil {
+					return nil, err
+				}
+				r.OldestAge = age.Round(time.Second).String()
+				if age > maxAge {
+					r.Reasons = append(r.Reasons, fmt.Sprintf("oldest %s > %s", r.OldestAge, maxAge))
+				}
+			}
+			if len(r.Reasons) > 0 {
+				r.Status = CheckStatusBreach
+			}
+			results = append(results, r)
+		}
+		if !matched {
+			results = append(results, checkResult{
+				Status:  CheckStatusNoQueue,
+				Rule:    rule.String(),
+				Reasons: []string{fmt.Sprintf("no queue matches filter %q", rule.Filter)},
+			})
+		}
+	}
+	return results, nil
+}
+
+func (rule checkRule) String() string {
+	parts := []string{"filter=" + rule.Filter}
+	if rule.MaxMessages != nil {
+		parts = append(parts, fmt.Sprintf("maxMessages=%d", *rule.MaxMessages))
+	}
+	if rule.MaxAge != "" {
+		parts = append(parts, "maxAge="+rule.MaxAge)
+	}
+	return strings.Join(parts, " ")
+}
+
+func writeCheckReport(w io.Writer, asJson bool, results []checkResult) error {
+	if asJson {
+		buf, err := jsonMarshal(results)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(buf))
+		return err
+	}
+	for _, r := range results {
+		line := fmt.Sprintf("status=%s queue=%s messages=%d", r.Status, r.Queue, r.Messages)
+		if r.Status == CheckStatusNoQueue {
+			line = "status=" + r.Status
+		}
+		if r.OldestAge != "" {
+			line += " oldest=" + r.OldestAge
+		}
+		if len(r.Reasons) > 0 {
+			line += fmt.Sprintf(" reason=%q", strings.Join(r.Reasons, "; "))
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkRules(flags cliFlags) ([]checkRule, error) {
+	if flags.rulesFile != "" {
+		buf, err := ioutil.ReadFile(flags.rulesFile)
+		if err != nil {
+			return nil, err
+		}
+		var rules []checkRule
+		if err := json.Unmarshal(buf, &rules); err != nil {
+			return nil, fmt.Errorf("failed reading %s: %v", flags.rulesFile, err)
+		}
+		return rules, nil
+	}
+	rule := checkRule{Filter: flags.filter}
+	if flags.maxMessages >= 0 {
+		rule.MaxMessages = aws.Int64(flags.maxMessages)
+	}
+	if flags.maxAge > 0 {
+		rule.MaxAge = flags.maxAge.String()
+	}
+	if rule.MaxMessages == nil && rule.MaxAge == "" {
+		return nil, errors.New("--check needs --max-messages, --max-age or --rules")
+	}
+	return []checkRule{rule}, nil
+}
+
+// oldestMessageAge is the latest CloudWatch ApproximateAgeOfOldestMessage, which lags the queue by a minute or two.
+// Messages are never received, that would raise their receive count and could redrive them to a dead letter queue
+func oldestMessageAge(ctx context.Context, metrics cloudwatchiface.CloudWatchAPI, queueName string, now time.Time) (time.Duration, error) {
+	out, err := metrics.GetMetricStatisticsWithContext(ctx, &cloudwatch.GetMetricStatisticsInput{
+		Namespace:  aws.String("AWS/SQS"),
+		MetricName: aws.String("ApproximateAgeOfOldestMessage"),
+		Dimensions: []*cloudwatch.Dimension{{Name: aws.String("QueueName"), Value: aws.String(queueName)}},
+		StartTime:  aws.Time(now.Add(-15 * time.Minute)),
+		EndTime:    aws.Time(now),
+		Period:     aws.Int64(60),
+		Statistics: []*string{aws.String(cloudwatch.StatisticMaximum)},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed reading the oldest message age of %s: %v", queueName, err)
+	}
+	var latest *cloudwatch.Datapoint
+	for _, d := range out.Datapoints {
+		if latest == nil || aws.TimeValue(d.Timestamp).After(aws.TimeValue(latest.Timestamp)) {
+			latest = d
+		}
+	}
+	if latest == nil {
+		return 0, fmt.Errorf("no ApproximateAgeOfOldestMessage for %s in CloudWatch in the last 15 minutes", queueName)
+	}
+	return time.Duration(aws.Float64Value(latest.Maximum)) * time.Second, nil
+}
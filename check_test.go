@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/NearlyUnique/awsqueue/queue"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/cloudwatch/cloudwatchiface"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_check_thresholds(t *testing.T) {
+	result := QueueSearchResult{
+		Attrs: []map[string]flexiString{
+			{queue.AttrKeyQueueName: "orders-dlq", queue.AttrKeyQueueUrl: "http://any.com/orders-dlq", sqs.QueueAttributeNameApproximateNumberOfMessages: "12"},
+			{queue.AttrKeyQueueName: "payments-dlq", queue.AttrKeyQueueUrl: "http://any.com/payments-dlq", sqs.QueueAttributeNameApproximateNumberOfMessages: "0"},
+			{queue.AttrKeyQueueName: "orders", queue.AttrKeyQueueUrl: "http://any.com/orders", sqs.QueueAttributeNameApproximateNumberOfMessages: "500"},
+		},
+	}
+	noAge := func(string) (time.Duration, error) { return 0, nil }
+
+	t.Run("queues over the message limit breach", func(t *testing.T) {
+		results, err := evaluateChecks([]checkRule{{Filter: "-dlq", MaxMessages: aws.Int64(10)}}, result, noAge)
+
+		require.NoError(t, err)
+		require.Len(t, results, 2)
+		assert.Equal(t, CheckStatusBreach, results[0].Status)
+		assert.Equal(t, "orders-dlq", results[0].Queue)
+		assert.Equal(t, CheckStatusOK, results[1].Status)
+	})
+	t.Run("age is only sampled for queues with messages", func(t *testing.T) {
+		sampled := map[string]bool{}
+		age := func(url string) (time.Duration, error) {
+			sampled[url] = true
+			return 2 * time.Hour, nil
+		}
+
+		results, err := evaluateChecks([]checkRule{{Filter: "-dlq", MaxAge: "1h"}}, result, age)
+
+		require.NoError(t, err)
+		assert.Equal(t, map[string]bool{"orders-dlq": true}, sampled)
+		assert.Equal(t, CheckStatusBreach, results[0].Status)
+		assert.Equal(t, "2h0m0s", results[0].OldestAge)
+	})
+	t.Run("an invalid age is an error", func(t *testing.T) {
+		_, err := evaluateChecks([]checkRule{{MaxAge: "soon"}}, result, noAge)
+
+		assert.Error(t, err)
+	})
+	t.Run("a rule matching no queue fails", func(t *testing.T) {
+		var buf bytes.Buffer
+		results, err := evaluateChecks([]checkRule{{Filter: "ordrs-dlq", MaxMessages: aws.Int64(10)}}, result, noAge)
+		require.NoError(t, err)
+
+		require.Len(t, results, 1)
+		assert.Equal(t, CheckStatusNoQueue, results[0].Status)
+		require.NoError(t, writeCheckReport(&buf, false, results))
+		assert.Equal(t, "status=NO_QUEUE reason=\"no queue matches filter \\\"ordrs-dlq\\\"\"\n", buf.String())
+	})
+	t.Run("the report is one line per queue", func(t *testing.T) {
+		var buf bytes.Buffer
+		results, err := evaluateChecks([]checkRule{{Filter: "orders-dlq", MaxMessages: aws.Int64(10)}}, result, noAge)
+		require.NoError(t, err)
+
+		require.NoError(t, writeCheckReport(&buf, false, results))
+
+		assert.Equal(t, "status=BREACH queue=orders-dlq messages=12 reason=\"messages 12 > 10\"\n", buf.String())
+	})
+}
+
+func Test_check_rules_from_flags(t *testing.T) {
+	t.Run("thresholds are required", func(t *testing.T) {
+		fs, err := parseFlags([]string{"--check"})
+		require.NoError(t, err)
+
+		_, err = checkRules(fs)
+
+		assert.Error(t, err)
+	})
+	t.Run("a single rule uses the filter", func(t *testing.T) {
+		fs, err := parseFlags([]string{"--check", "-f", "-dlq", "--max-messages", "0"})
+		require.NoError(t, err)
+
+		rules, err := checkRules(fs)
+
+		require.NoError(t, err)
+		require.Len(t, rules, 1)
+		assert.Equal(t, "-dlq", rules[0].Filter)
+		assert.Equal(t, int64(0), *rules[0].MaxMessages)
+	})
+}
+
+type fakeMetrics struct {
+	cloudwatchiface.CloudWatchAPI
+	input      *cloudwatch.GetMetricStatisticsInput
+	datapoints []*cloudwatch.Datapoint
+}
+
+func (f *fakeMetrics) GetMetricStatisticsWithContext(_ aws.Context, input *cloudwatch.GetMetricStatisticsInput, _ ...request.Option) (*cloudwatch.GetMetricStatisticsOutput, error) {
+	f.input = input
+	return &cloudwatch.GetMetricStatisticsOutput{Datapoints: f.datapoints}, nil
+}
+
+func Test_oldest_message_age_comes_from_cloudwatch(t *testing.T) {
+	now := time.Date(2019, 11, 21, 12, 0, 0, 0, time.UTC)
+	t.Run("the latest datapoint is used", func(t *testing.T) {
+		metrics := &fakeMetrics{datapoints: []*cloudwatch.Datapoint{
+			{Timestamp: aws.Time(now.Add(-2 * time.Minute)), Maximum: aws.Float64(3600)},
+			{Timestamp: aws.Time(now.Add(-10 * time.Minute)), Maximum: aws.Float64(60)},
+		}}
+
+		age, err := oldestMessageAge(context.Background(), metrics, "orders-dlq", now)
+
+		require.NoError(t, err)
+		assert.Equal(t, time.Hour, age)
+		assert.Equal(t, "orders-dlq", *metrics.input.Dimensions[0].Value)
+	})
+	t.Run("no datapoints is an error rather than no age", func(t *testing.T) {
+		_, err := oldestMessageAge(context.Background(), &fakeMetrics{}, "orders-dlq", now)
+
+		assert.Error(t, err)
+	})
+}
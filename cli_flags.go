@@ -1,13 +1,18 @@
 package main
 
 import (
+	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/spf13/pflag"
 )
 
 type (
 	cliFlags struct {
+		// action is set when a subcommand is used, otherwise it is derived from the legacy flags
+		action        CmdAction
 		filter        string
 		asJson        bool
 		allMessages   bool
@@ -17,25 +22,321 @@ type (
 		sendMsgSrc    string
 		showVersion   bool
 		noInteraction bool
+		yes           bool
 		maxUnique     int64
+		archiveDir    string
+		restoreDir    string
+		rate          string
+		concurrency   int
+		burst         int
+		cloneTo       string
+		cloneRegion   string
+		dryRun        bool
+		setAttrs      map[string]string
+		topology      string
+		check         bool
+		maxMessages   int64
+		maxAge        time.Duration
+		rulesFile     string
+		tags          map[string]string
+		tagQueue      map[string]string
+		untagQueue    []string
+		args          []string
+		listen        string
+		cacheInterval time.Duration
+		configFile    string
+		environment   string
+		profile       string
+		endpoint      string
+		aliases       map[string]string
+		sortBy        string
+		desc          bool
+		top           int
+		columns       []string
+		queueURL      string
+		queueName     string
+		ownerAccount  string
+		multi         bool
+		role          string
+		moveTo        string
+		toAccount     string
+		toRegion      string
+		toProfile     string
+		toRole        string
+		deleteSource  bool
+		journal       string
+		transform     transformOptions
+		preview       int
+		routesFile    string
+		timeout       time.Duration
+		envelope      bool
+		tz            string
+		sentAfter     string
+		sentBefore    string
+		// changed records the flags given on the command line, so config only fills in the rest
+		changed map[string]bool
+	}
+	subcommand struct {
+		name    string
+		action  CmdAction
+		summary string
+		flags   func(fs *pflag.FlagSet, flags *cliFlags)
 	}
 )
 
+var subcommands = []subcommand{
+	{"list", CmdActionList, "list queues and their message counts", func(fs *pflag.FlagSet, flags *cliFlags) {
+		listFlags(fs, flags)
+	}},
+	{"read", CmdActionRead, "read messages into result.json and summary.json", func(fs *pflag.FlagSet, flags *cliFlags) {
+		queueFlags(fs, flags)
+		readFlags(fs, flags)
+		fs.StringVar(&flags.archiveDir, "archive", "", "also write every Message into this directory, one file per message plus a manifest")
+	}},
+	{"send", CmdActionWrite, "send messages from a result.json written by read", func(fs *pflag.FlagSet, flags *cliFlags) {
+		queueFlags(fs, flags)
+		fs.StringVarP(&flags.sendMsgSrc, "source", "s", "", "json source file To send Messages")
+		sendFlags(fs, flags)
+		transformFlags(fs, flags)
+		fs.BoolVar(&flags.dryRun, "dry-run", false, "show the first --preview Messages before and after the transform and exit")
+	}},
+	{"restore", CmdActionRestore, "send an archive written by read --archive", func(fs *pflag.FlagSet, flags *cliFlags) {
+		queueFlags(fs, flags)
+		fs.StringVar(&flags.restoreDir, "from", "", "archive directory To send Messages From")
+	}},
+	{"move", CmdActionMove, "copy messages to a queue in any account or region, optionally deleting them", func(fs *pflag.FlagSet, flags *cliFlags) {
+		queueFlags(fs, flags)
+		fs.Int64VarP(&flags.visibility, "visibility-timeout", "t", 60, "messages will be unavailable for this many seconds while being moved")
+		fs.StringVar(&flags.moveTo, "to", "", "target Queue url, ARN or name")
+		fs.StringVar(&flags.toAccount, "to-owner-account", "", "when --to is a name, the AWS account id that owns the target Queue")
+		fs.StringVar(&flags.toRegion, "to-region", "", "target region, defaults To the region in --to then --region")
+		fs.StringVar(&flags.toProfile, "to-profile", "", "AWS profile for the target, defaults To --profile")
+		fs.StringVar(&flags.toRole, "to-role", "", "IAM role ARN To assume for the target")
+		fs.BoolVar(&flags.deleteSource, "delete-source", false, "delete each Message From the source once it has been sent")
+		fs.StringVar(&flags.journal, "journal", "move-journal.jsonl", "record each Message sent and deleted, run again with the same journal To resume")
+		transformFlags(fs, flags)
+		fs.BoolVar(&flags.dryRun, "dry-run", false, "show the first --preview Messages before and after the transform, then release them")
+		sentWindowFlags(fs, flags)
+	}},
+	{"route", CmdActionRoute, "send each message to a queue chosen by --routes rules, then delete it", func(fs *pflag.FlagSet, flags *cliFlags) {
+		queueFlags(fs, flags)
+		fs.Int64VarP(&flags.visibility, "visibility-timeout", "t", 60, "messages will be unavailable for this many seconds while being routed")
+		fs.StringVar(&flags.routesFile, "routes", "", "yaml file of routes matching custom attributes, AWS attributes or body fields")
+		fs.BoolVar(&flags.dryRun, "dry-run", false, "count the Messages per route without sending, then release them")
+	}},
+	{"exec", CmdActionExec, "run a command for each message, usage: exec [flags] -- COMMAND [ARGS]", func(fs *pflag.FlagSet, flags *cliFlags) {
+		queueFlags(fs, flags)
+		fs.Int64VarP(&flags.visibility, "visibility-timeout", "t", 30, "messages are held this many seconds, extended every half timeout while the command runs")
+		fs.IntVar(&flags.concurrency, "concurrency", 1, "number of commands To run at once")
+		fs.DurationVar(&flags.timeout, "timeout", 5*time.Minute, "stop the command after this long and release the Message")
+		fs.BoolVar(&flags.envelope, "envelope", false, "write the whole Message as json on stdin, instead of the body with attributes in AWSQUEUE_ATTR_<NAME> env vars")
+		sentWindowFlags(fs, flags)
+	}},
+	{"purge", CmdActionPurge, "delete every message in the queue", func(fs *pflag.FlagSet, flags *cliFlags) {
+		queueFlags(fs, flags)
+		fs.BoolVar(&flags.dryRun, "dry-run", false, "display the Queue that would be purged and exit")
+	}},
+	{"attrs", CmdActionSetAttrs, "show or --set queue attributes", func(fs *pflag.FlagSet, flags *cliFlags) {
+		queueFlags(fs, flags)
+		fs.StringToStringVar(&flags.setAttrs, "set", nil, "set attributes of the Queue, "+strings.Join(settableKeys(), ", "))
+		fs.BoolVar(&flags.dryRun, "dry-run", false, "display the changes that would be made and exit")
+	}},
+	{"clone", CmdActionClone, "create a new queue with the same settings and tags", func(fs *pflag.FlagSet, flags *cliFlags) {
+		queueFlags(fs, flags)
+		fs.StringVar(&flags.cloneTo, "name", "", "name of the new Queue")
+		fs.StringVar(&flags.cloneRegion, "target-region", "", "create the new Queue in this region, defaults To --region")
+		fs.BoolVar(&flags.dryRun, "dry-run", false, "display the CreateQueue request and exit")
+	}},
+	{"tag", CmdActionTag, "add or remove queue tags", func(fs *pflag.FlagSet, flags *cliFlags) {
+		queueFlags(fs, flags)
+		fs.StringToStringVar(&flags.tagQueue, "add", nil, "add or update tags on the Queue, e.g. team=payments")
+		fs.StringSliceVar(&flags.untagQueue, "remove", nil, "remove tags From the Queue by key")
+		fs.BoolVar(&flags.dryRun, "dry-run", false, "display the changes that would be made and exit")
+	}},
+	{"topology", CmdActionTopology, "show each queue with its dead letter queue", func(fs *pflag.FlagSet, flags *cliFlags) {
+		filterFlags(fs, flags)
+		fs.StringVar(&flags.topology, "format", TopologyText, "output as text, json or dot")
+	}},
+	{"browse", CmdActionBrowse, "full screen browser for queues and messages", func(fs *pflag.FlagSet, flags *cliFlags) {
+		filterFlags(fs, flags)
+		fs.BoolVar(&flags.allMessages, "all", false, "include Queues with no Messages")
+		fs.Int64VarP(&flags.visibility, "visibility-timeout", "t", 300, "opened messages will be unavailable for this many seconds unless released")
+	}},
+	{"serve-metrics", CmdActionMetrics, "serve queue metrics for Prometheus on /metrics", func(fs *pflag.FlagSet, flags *cliFlags) {
+		filterFlags(fs, flags)
+		fs.StringVar(&flags.listen, "listen", ":9434", "address To serve /metrics on")
+		fs.DurationVar(&flags.cacheInterval, "cache-interval", 0, "list Queues at most this often, by default on every scrape")
+	}},
+	{"diff", CmdActionDiff, "compare two result.json files written by read, usage: diff BEFORE AFTER", func(fs *pflag.FlagSet, flags *cliFlags) {
+		fs.BoolVarP(&flags.asJson, "json", "j", false, "report as json")
+	}},
+	{"check", CmdActionCheck, "check queues against thresholds, exits 0 when OK, 2 on breach or a rule matching no queue and 1 on error", func(fs *pflag.FlagSet, flags *cliFlags) {
+		filterFlags(fs, flags)
+		fs.BoolVarP(&flags.asJson, "json", "j", false, "report as json")
+		checkFlags(fs, flags)
+	}},
+}
+
 func parseFlags(args []string) (cliFlags, error) {
+	if len(args) > 0 {
+		for _, cmd := range subcommands {
+			if cmd.name == args[0] {
+				return parseSubcommand(cmd, args[1:])
+			}
+		}
+	}
+	return parseLegacyFlags(args)
+}
+
+func parseSubcommand(cmd subcommand, args []string) (cliFlags, error) {
+	flags := cliFlags{action: cmd.action}
+	fs := pflag.NewFlagSet("awsqueue "+cmd.name, pflag.ExitOnError)
+	globalFlags(fs, &flags)
+	cmd.flags(fs, &flags)
+	fs.Usage = func() {
+		_, _ = fmt.Fprintf(os.Stderr, "Usage: awsqueue %s [flags]\n\n%s\n\n", cmd.name, cmd.summary)
+		fs.PrintDefaults()
+	}
+	err := fs.Parse(args)
+	flags.changed = changedFlags(fs)
+	flags.args = fs.Args()
+	return flags, err
+}
+
+// parseLegacyFlags accepts the single flat flag set used before subcommands, action flags are deprecated
+func parseLegacyFlags(args []string) (cliFlags, error) {
 	var flags cliFlags
 
 	fs := pflag.NewFlagSet("default", pflag.ExitOnError)
-	fs.StringVarP(&flags.filter, "filter", "f", "", "substring search To filter queues")
-	fs.BoolVarP(&flags.asJson, "json", "j", false, "Output format defaults To summary (count,name), asJson fives fuller output")
-	fs.BoolVar(&flags.allMessages, "all", false, "If true shows message attributes event when there are no Messages in the Queue")
-	fs.StringVar(&flags.regionArg, "region", os.Getenv("AWS_REGION"), "AWS region, defaults From env variable (AWS_REGION) then To eu-west-1")
+	globalFlags(fs, &flags)
+	listFlags(fs, &flags)
+	readFlags(fs, &flags)
+	sendFlags(fs, &flags)
+	checkFlags(fs, &flags)
+	queueRefFlags(fs, &flags)
+	transformFlags(fs, &flags)
 	fs.BoolVar(&flags.read, "read", false, "read Messages and meta data, will only run if a single Queue can be resolved via --filter")
-	fs.Int64VarP(&flags.visibility, "visibility-timeout", "t", 20, "when --read is specified, messages will be unavailable for this many seconds")
 	fs.StringVar(&flags.sendMsgSrc, "write-source", "", "json source file To send Messages, will only run if a single Queue can be resolved via --filter")
+	fs.StringVar(&flags.archiveDir, "archive", "", "read Messages into this directory, one file per message plus a manifest, will only run if a single Queue can be resolved via --filter")
+	fs.StringVar(&flags.restoreDir, "restore", "", "send Messages From an --archive directory, will only run if a single Queue can be resolved via --filter")
+	fs.StringVar(&flags.cloneTo, "clone-to", "", "create a new Queue with this name and the same settings and tags, will only run if a single Queue can be resolved via --filter")
+	fs.StringVar(&flags.cloneRegion, "clone-region", "", "when --clone-to is specified, create the new Queue in this region, defaults To --region")
+	fs.StringToStringVar(&flags.setAttrs, "set", nil, "set attributes of the Queue, "+strings.Join(settableKeys(), ", ")+", will only run if a single Queue can be resolved via --filter")
+	fs.StringVar(&flags.topology, "topology", "", "show each Queue with its dead letter Queue as text, json or dot")
+	fs.BoolVar(&flags.check, "check", false, "check Queues matching --filter against thresholds, exits 0 when OK, 2 on breach or a rule matching no queue and 1 on error")
+	fs.StringToStringVar(&flags.tagQueue, "tag-queue", nil, "add or update tags on the Queue, will only run if a single Queue can be resolved via --filter")
+	fs.StringSliceVar(&flags.untagQueue, "untag-queue", nil, "remove tags From the Queue by key, will only run if a single Queue can be resolved via --filter")
+	fs.BoolVar(&flags.dryRun, "dry-run", false, "display the changes that would be made and exit")
+
+	deprecated := map[string]string{
+		"read":         "use 'awsqueue read'",
+		"write-source": "use 'awsqueue send --source'",
+		"archive":      "use 'awsqueue read --archive'",
+		"restore":      "use 'awsqueue restore --from'",
+		"clone-to":     "use 'awsqueue clone --name'",
+		"clone-region": "use 'awsqueue clone --target-region'",
+		"set":          "use 'awsqueue attrs --set'",
+		"topology":     "use 'awsqueue topology --format'",
+		"check":        "use 'awsqueue check'",
+		"tag-queue":    "use 'awsqueue tag --add'",
+		"untag-queue":  "use 'awsqueue tag --remove'",
+	}
+	for name, usage := range deprecated {
+		_ = fs.MarkDeprecated(name, usage)
+	}
+	fs.Usage = func() {
+		_, _ = fmt.Fprintf(os.Stderr, "Usage: awsqueue [command] [flags]\n\nCommands:\n")
+		for _, cmd := range subcommands {
+			_, _ = fmt.Fprintf(os.Stderr, "  %-14s %s\n", cmd.name, cmd.summary)
+		}
+		_, _ = fmt.Fprintf(os.Stderr, "\nWithout a command queues are listed, flags:\n")
+		fs.PrintDefaults()
+	}
+
+	err := fs.Parse(args)
+	flags.changed = changedFlags(fs)
+	return flags, err
+}
+
+func globalFlags(fs *pflag.FlagSet, flags *cliFlags) {
+	fs.StringVar(&flags.regionArg, "region", os.Getenv("AWS_REGION"), "AWS region, defaults From env variable (AWS_REGION), the config file then To eu-west-1")
 	fs.BoolVar(&flags.showVersion, "version", false, "display version and exit")
 	fs.BoolVar(&flags.noInteraction, "no-interaction", false, "for CI and scripts to prevent user interaction")
+	fs.BoolVar(&flags.yes, "yes", false, "agree to purge, tag, clone and attrs --set without asking, needed with --no-interaction")
+	fs.StringVar(&flags.configFile, "config", "", "config file, defaults To ~/.config/awsqueue/config.yaml then ./.awsqueue.yaml")
+	fs.StringVar(&flags.environment, "env", "", "named environment From the config file")
+	fs.StringVar(&flags.profile, "profile", "", "AWS profile, defaults From the config file then env variable (AWS_PROFILE)")
+	fs.StringVar(&flags.endpoint, "endpoint", "", "SQS endpoint url, e.g. for localstack")
+	fs.StringVar(&flags.role, "role", "", "IAM role ARN To assume")
+	fs.StringVar(&flags.tz, "tz", "", "show timestamps as RFC3339 in UTC, local or a zone such as Europe/London, defaults To local time without an offset")
+}
+
+func changedFlags(fs *pflag.FlagSet) map[string]bool {
+	changed := make(map[string]bool)
+	fs.Visit(func(f *pflag.Flag) {
+		changed[f.Name] = true
+	})
+	return changed
+}
+
+func filterFlags(fs *pflag.FlagSet, flags *cliFlags) {
+	fs.StringVarP(&flags.filter, "filter", "f", "", "substring search To filter queues")
+	fs.StringToStringVar(&flags.tags, "tag", nil, "only include Queues with these tags, e.g. team=payments")
+}
+
+func listFlags(fs *pflag.FlagSet, flags *cliFlags) {
+	filterFlags(fs, flags)
+	fs.BoolVarP(&flags.asJson, "json", "j", false, "Output format defaults To summary (count,name), asJson fives fuller output")
+	fs.BoolVar(&flags.allMessages, "all", false, "If true shows message attributes event when there are no Messages in the Queue")
+	fs.StringVar(&flags.sortBy, "sort", SortByName, "order Queues by name, visible, inflight, created or modified")
+	fs.BoolVar(&flags.desc, "desc", false, "sort in descending order")
+	fs.IntVar(&flags.top, "top", 0, "only show the first N Queues after sorting")
+	fs.StringSliceVar(&flags.columns, "columns", []string{ColumnVisible}, "columns To show before the name, any of visible, inflight, delayed, created, age (since created), modified (since last modified)")
+}
+
+// queueFlags are for commands that will only run if a single Queue can be resolved via --filter
+func queueFlags(fs *pflag.FlagSet, flags *cliFlags) {
+	filterFlags(fs, flags)
+	fs.BoolVar(&flags.allMessages, "all", false, "include Queues with no Messages when resolving --filter")
+	queueRefFlags(fs, flags)
+}
+
+// queueRefFlags address a Queue without listing, e.g. in another account
+func queueRefFlags(fs *pflag.FlagSet, flags *cliFlags) {
+	fs.StringVar(&flags.queueURL, "queue-url", "", "use this Queue url or ARN instead of --filter, Queues are not listed")
+	fs.StringVar(&flags.queueName, "queue-name", "", "use the Queue with this exact name instead of --filter, Queues are not listed")
+	fs.StringVar(&flags.ownerAccount, "owner-account", "", "with --queue-name, the AWS account id that owns the Queue")
+}
+
+func readFlags(fs *pflag.FlagSet, flags *cliFlags) {
+	fs.Int64VarP(&flags.visibility, "visibility-timeout", "t", 20, "when reading, messages will be unavailable for this many seconds")
 	fs.Int64Var(&flags.maxUnique, "max-unique", 10, "when attribute values are unique, summary will display up to max-unique instances")
+	fs.BoolVar(&flags.multi, "multi", false, "read every Queue matching --filter concurrently into result-<name>.json, with one summary.json broken down per Queue")
+	sentWindowFlags(fs, flags)
+}
 
-	err := fs.Parse(args)
-	return flags, err
+// sentWindowFlags select Messages by when they were sent, the rest are made visible again as soon as they are received
+func sentWindowFlags(fs *pflag.FlagSet, flags *cliFlags) {
+	fs.StringVar(&flags.sentAfter, "sent-after", "", "only Messages sent at or after this time, e.g. 2019-11-21T12:00:00Z, or this long ago, e.g. 2h; earlier Messages are released straight away")
+	fs.StringVar(&flags.sentBefore, "sent-before", "", "only Messages sent before this time, e.g. 2019-11-21 13:00, or this long ago, e.g. 30m; later Messages are released straight away")
+}
+
+func sendFlags(fs *pflag.FlagSet, flags *cliFlags) {
+	fs.StringVar(&flags.rate, "rate", "", "when sending, limit To N/s or N/m, default is unlimited")
+	fs.IntVar(&flags.concurrency, "concurrency", 1, "when sending, number of concurrent senders")
+	fs.IntVar(&flags.burst, "burst", 1, "when --rate is specified, allow bursts of up To this many Messages")
+}
+
+// transformFlags rewrite each Message before it is sent
+func transformFlags(fs *pflag.FlagSet, flags *cliFlags) {
+	fs.StringVar(&flags.transform.rulesFile, "transform", "", "yaml or json file of attribute and body rename, set and delete rules")
+	fs.StringVar(&flags.transform.template, "template", "", "Go template producing the new body From .Body, .Raw and .Attributes")
+	fs.StringVar(&flags.transform.command, "transform-command", "", "shell command reading the body on stdin and writing the new body To stdout")
+	fs.IntVar(&flags.preview, "preview", 3, "with --dry-run, the number of Messages To show")
+}
+
+func checkFlags(fs *pflag.FlagSet, flags *cliFlags) {
+	fs.Int64Var(&flags.maxMessages, "max-messages", -1, "when checking, breach if a Queue has more than this many Messages")
+	fs.DurationVar(&flags.maxAge, "max-age", 0, "when checking, breach if the oldest Message is older than this, e.g. 1h, from CloudWatch ApproximateAgeOfOldestMessage")
+	fs.StringVar(&flags.rulesFile, "rules", "", "when checking, json file of rules [{\"filter\":\"-dlq\",\"maxMessages\":0,\"maxAge\":\"1h\"}]")
 }
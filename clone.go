@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+// AttrKeySqsManagedSseEnabled is newer than the sdk's attribute name constants
+const AttrKeySqsManagedSseEnabled = "SqsManagedSseEnabled"
+
+// cloneableAttributes are the settable queue attributes copied to a clone, read-only attributes such as
+// QueueArn and CreatedTimestamp are never copied, neither is Policy as it names the source queue's ARN
+var cloneableAttributes = []string{
+	sqs.QueueAttributeNameDelaySeconds,
+	sqs.QueueAttributeNameMaximumMessageSize,
+	sqs.QueueAttributeNameMessageRetentionPeriod,
+	sqs.QueueAttributeNameReceiveMessageWaitTimeSeconds,
+	sqs.QueueAttributeNameVisibilityTimeout,
+	sqs.QueueAttributeNameRedrivePolicy,
+	AttrKeyRedriveAllowPolicy,
+	sqs.QueueAttributeNameFifoQueue,
+	sqs.QueueAttributeNameContentBasedDeduplication,
+	sqs.QueueAttributeNameKmsMasterKeyId,
+	sqs.QueueAttributeNameKmsDataKeyReusePeriodSeconds,
+	AttrKeySqsManagedSseEnabled,
+}
+
+type cloneOptions struct {
+	svc         *sqs.SQS
+	target      *sqs.SQS
+	queueURL    string
+	queueAttrs  map[string]flexiString
+	name        string
+	dryRun      bool
+	interaction interactionType
+	yes         bool
+	ctx         context.Context
+}
+
+func cloneQueue(options cloneOptions) error {
+	tags, err := options.svc.ListQueueTagsWithContext(options.ctx, &sqs.ListQueueTagsInput{QueueUrl: &options.queueURL})
+	if err != nil {
+		return err
+	}
+	input, err := cloneQueueInput(options.name, options.queueAttrs, tags.Tags)
+	if err != nil {
+		return err
+	}
+	if dlq := dropForeignRedrivePolicy(input, *options.target.Config.Region); dlq != "" {
+		_, _ = fmt.Fprintf(os.Stderr, "WARNING:RedrivePolicy not copied, its dead letter queue %s is not in %s, set one with 'attrs --set' once there is a dead letter queue there\n",
+			dlq, *options.target.Config.Region)
+	}
+	fmt.Printf("CreateQueue in %s\n%s\n", *options.target.Config.Region, input.String())
+	if options.dryRun {
+		return nil
+	}
+	ok, err := confirm("Create queue?", options.interaction, options.yes)
+	if err != nil || !ok {
+		return err
+	}
+	out, err := options.target.CreateQueueWithContext(options.ctx, input)
+	if err != nil {
+		return err
+	}
+	fmt.Println(aws.StringValue(out.QueueUrl))
+	return nil
+}
+
+func cloneQueueInput(name string, attrs map[string]flexiString, tags map[string]*string) (*sqs.CreateQueueInput, error) {
+	if name == "" {
+		return nil, errors.New("a name is required for the new queue")
+	}
+	input := sqs.CreateQueueInput{
+		QueueName:  aws.String(name),
+		Attributes: make(map[string]*string),
+	}
+	for _, key := range cloneableAttributes {
+		if value, ok := attrs[key]; ok && value != "" {
+			input.Attributes[key] = aws.String(value.String())
+		}
+	}
+	fifo := input.Attributes[sqs.QueueAttributeNameFifoQueue] != nil && *input.Attributes[sqs.QueueAttributeNameFifoQueue] == "true"
+	if fifo != strings.HasSuffix(name, ".fifo") {
+		return nil, errors.New("FIFO queue names must end with .fifo, and only FIFO queue names may")
+	}
+	if !fifo {
+		// only valid on FIFO queues, some responses include it as false
+		delete(input.Attributes, sqs.QueueAttributeNameFifoQueue)
+		delete(input.Attributes, sqs.QueueAttributeNameContentBasedDeduplication)
+	}
+	if input.Attributes[sqs.QueueAttributeNameKmsMasterKeyId] != nil {
+		// SQS managed and KMS encryption cannot both be asked for
+		delete(input.Attributes, AttrKeySqsManagedSseEnabled)
+	}
+	if len(tags) > 0 {
+		input.Tags = tags
+	}
+	return &input, nil
+}
+
+// dropForeignRedrivePolicy removes a RedrivePolicy whose dead letter queue is in another region,
+// CreateQueue would fail with it, and returns that queue's ARN
+func dropForeignRedrivePolicy(input *sqs.CreateQueueInput, region string) string {
+	policy, ok := input.Attributes[sqs.QueueAttributeNameRedrivePolicy]
+	if !ok {
+		return ""
+	}
+	var redrive struct {
+		DeadLetterTargetArn string `json:"deadLetterTargetArn"`
+	}
+	if err := json.Unmarshal([]byte(aws.StringValue(policy)), &redrive); err != nil {
+		return ""
+	}
+	parsed, err := arn.Parse(redrive.DeadLetterTargetArn)
+	if err != nil || parsed.Region == region {
+		return ""
+	}
+	delete(input.Attributes, sqs.QueueAttributeNameRedrivePolicy)
+	return redrive.DeadLetterTargetArn
+}
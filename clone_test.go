@@ -0,0 +1,72 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/NearlyUnique/awsqueue/queue"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_a_clone_copies_settable_attributes_and_tags(t *testing.T) {
+	attrs := map[string]flexiString{
+		queue.AttrKeyQueueName:                            "source",
+		sqs.QueueAttributeNameVisibilityTimeout:           "45",
+		sqs.QueueAttributeNameRedrivePolicy:               `{"deadLetterTargetArn":"arn:aws:sqs:eu-west-1:1:dlq","maxReceiveCount":5}`,
+		sqs.QueueAttributeNameQueueArn:                    "arn:aws:sqs:eu-west-1:1:source",
+		sqs.QueueAttributeNameCreatedTimestamp:            "1574154612",
+		sqs.QueueAttributeNameApproximateNumberOfMessages: "3",
+	}
+
+	input, err := cloneQueueInput("target", attrs, map[string]*string{"team": aws.String("payments")})
+
+	require.NoError(t, err)
+	assert.Equal(t, "target", *input.QueueName)
+	assert.Equal(t, "45", *input.Attributes[sqs.QueueAttributeNameVisibilityTimeout])
+	assert.Contains(t, *input.Attributes[sqs.QueueAttributeNameRedrivePolicy], "maxReceiveCount")
+	assert.NotContains(t, input.Attributes, sqs.QueueAttributeNameQueueArn)
+	assert.NotContains(t, input.Attributes, sqs.QueueAttributeNameCreatedTimestamp)
+	assert.NotContains(t, input.Attributes, sqs.QueueAttributeNameApproximateNumberOfMessages)
+	assert.NotContains(t, input.Attributes, queue.AttrKeyQueueName)
+	assert.Equal(t, "payments", *input.Tags["team"])
+}
+
+func Test_a_fifo_clone_must_be_named_fifo(t *testing.T) {
+	attrs := map[string]flexiString{sqs.QueueAttributeNameFifoQueue: "true"}
+
+	_, err := cloneQueueInput("target", attrs, nil)
+	assert.Error(t, err)
+
+	input, err := cloneQueueInput("target.fifo", attrs, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "true", *input.Attributes[sqs.QueueAttributeNameFifoQueue])
+
+	_, err = cloneQueueInput("target.fifo", map[string]flexiString{}, nil)
+	assert.Error(t, err)
+}
+
+func Test_a_clone_in_another_region_drops_the_redrive_policy(t *testing.T) {
+	attrs := map[string]flexiString{
+		sqs.QueueAttributeNameRedrivePolicy: `{"deadLetterTargetArn":"arn:aws:sqs:eu-west-1:1:dlq","maxReceiveCount":5}`,
+		AttrKeyRedriveAllowPolicy:           `{"redrivePermission":"allowAll"}`,
+		AttrKeySqsManagedSseEnabled:         "true",
+	}
+	t.Run("the same region keeps it", func(t *testing.T) {
+		input, err := cloneQueueInput("target", attrs, nil)
+		require.NoError(t, err)
+
+		assert.Empty(t, dropForeignRedrivePolicy(input, "eu-west-1"))
+		assert.Contains(t, input.Attributes, sqs.QueueAttributeNameRedrivePolicy)
+		assert.Equal(t, "true", *input.Attributes[AttrKeySqsManagedSseEnabled])
+		assert.Contains(t, *input.Attributes[AttrKeyRedriveAllowPolicy], "allowAll")
+	})
+	t.Run("another region drops it", func(t *testing.T) {
+		input, err := cloneQueueInput("target", attrs, nil)
+		require.NoError(t, err)
+
+		assert.Equal(t, "arn:aws:sqs:eu-west-1:1:dlq", dropForeignRedrivePolicy(input, "us-east-1"))
+		assert.NotContains(t, input.Attributes, sqs.QueueAttributeNameRedrivePolicy)
+	})
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	configDirName   = "awsqueue"
+	configFileName  = "config.yaml"
+	projectFileName = ".awsqueue.yaml"
+)
+
+type (
+	config struct {
+		Region            string                       `yaml:"region"`
+		Profile           string                       `yaml:"profile"`
+		Endpoint          string                       `yaml:"endpoint"`
+		Filter            string                       `yaml:"filter"`
+		VisibilityTimeout int64                        `yaml:"visibilityTimeout"`
+		Environments      map[string]configEnvironment `yaml:"environments"`
+		// Aliases map a name used with --filter to an exact queue url
+		Aliases map[string]string `yaml:"aliases"`
+	}
+	configEnvironment struct {
+		Region   string `yaml:"region"`
+		Profile  string `yaml:"profile"`
+		Endpoint string `yaml:"endpoint"`
+	}
+)
+
+// configPaths lists config files lowest precedence first, the user's then the project's
+func configPaths(explicit string) []string {
+	if explicit != "" {
+		return []string{explicit}
+	}
+	var paths []string
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			dir = filepath.Join(home, ".config")
+		}
+	}
+	if dir != "" {
+		paths = append(paths, filepath.Join(dir, configDirName, configFileName))
+	}
+	return append(paths, projectFileName)
+}
+
+// loadConfig merges the files in order, missing files are skipped
+func loadConfig(paths ...string) (config, error) {
+	var merged config
+	for _, path := range paths {
+		buf, err := ioutil.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return merged, err
+		}
+		var cfg config
+		if err := yaml.UnmarshalStrict(buf, &cfg); err != nil {
+			return merged, fmt.Errorf("failed reading %s: %v", path, err)
+		}
+		merged = merged.merge(cfg)
+	}
+	return merged, nil
+}
+
+func (c config) merge(over config) config {
+	if over.Region != "" {
+		c.Region = over.Region
+	}
+	if over.Profile != "" {
+		c.Profile = over.Profile
+	}
+	if over.Endpoint != "" {
+		c.Endpoint = over.Endpoint
+	}
+	if over.Filter != "" {
+		c.Filter = over.Filter
+	}
+	if over.VisibilityTimeout > 0 {
+		c.VisibilityTimeout = over.VisibilityTimeout
+	}
+	if len(over.Environments) > 0 {
+		environments := make(map[string]configEnvironment)
+		for k, v := range c.Environments {
+			environments[k] = v
+		}
+		for k, v := range over.Environments {
+			environments[k] = v
+		}
+		c.Environments = environments
+	}
+	if len(over.Aliases) > 0 {
+		aliases := make(map[string]string)
+		for k, v := range c.Aliases {
+			aliases[k] = v
+		}
+		for k, v := range over.Aliases {
+			aliases[k] = v
+		}
+		c.Aliases = aliases
+	}
+	return c
+}
+
+// applyConfig fills in anything not given on the command line, a named environment
+// takes precedence over AWS_REGION which takes precedence over the config defaults
+func applyConfig(flags cliFlags, cfg config) (cliFlags, error) {
+	env := configEnvironment{Region: cfg.Region, Profile: cfg.Profile, Endpoint: cfg.Endpoint}
+	if flags.environment != "" {
+		named, ok := cfg.Environments[flags.environment]
+		if !ok {
+			return flags, fmt.Errorf("unknown environment %q", flags.environment)
+		}
+		if named.Region != "" {
+			env.Region = named.Region
+			if !flags.changed["region"] {
+				flags.regionArg = named.Region
+			}
+		}
+		if named.Profile != "" {
+			env.Profile = named.Profile
+		}
+		if named.Endpoint != "" {
+			env.Endpoint = named.Endpoint
+		}
+	}
+	if flags.regionArg == "" {
+		flags.regionArg = env.Region
+	}
+	if flags.profile == "" {
+		flags.profile = env.Profile
+	}
+	if flags.endpoint == "" {
+		flags.endpoint = env.Endpoint
+	}
+	if !flags.changed["filter"] && cfg.Filter != "" {
+		flags.filter = cfg.Filter
+	}
+	if !flags.changed["visibility-timeout"] && cfg.VisibilityTimeout > 0 {
+		flags.visibility = cfg.VisibilityTimeout
+	}
+	flags.aliases = cfg.Aliases
+	return flags, nil
+}
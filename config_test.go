@@ -0,0 +1,99 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_config_files_are_merged_in_order(t *testing.T) {
+	dir, err := ioutil.TempDir("", "awsqueue")
+	require.NoError(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+	user := filepath.Join(dir, "user.yaml")
+	project := filepath.Join(dir, "project.yaml")
+	require.NoError(t, ioutil.WriteFile(user, []byte(`
+region: eu-west-1
+profile: dev
+environments:
+  prod: {profile: prod, region: us-east-1}
+aliases:
+  orders-dlq: https://sqs.eu-west-1.amazonaws.com/1/orders-dlq
+`), 0666))
+	require.NoError(t, ioutil.WriteFile(project, []byte(`
+profile: project
+visibilityTimeout: 60
+aliases:
+  payments-dlq: https://sqs.eu-west-1.amazonaws.com/1/payments-dlq
+`), 0666))
+
+	cfg, err := loadConfig(user, project, filepath.Join(dir, "missing.yaml"))
+
+	require.NoError(t, err)
+	assert.Equal(t, "eu-west-1", cfg.Region)
+	assert.Equal(t, "project", cfg.Profile)
+	assert.Equal(t, int64(60), cfg.VisibilityTimeout)
+	assert.Equal(t, "prod", cfg.Environments["prod"].Profile)
+	assert.Len(t, cfg.Aliases, 2)
+
+	t.Run("unknown keys are an error", func(t *testing.T) {
+		require.NoError(t, ioutil.WriteFile(project, []byte("regoin: eu-west-1\n"), 0666))
+
+		_, err := loadConfig(project)
+
+		assert.Error(t, err)
+	})
+}
+
+func Test_config_is_applied_under_the_command_line(t *testing.T) {
+	cfg := config{
+		Region:            "eu-west-1",
+		Profile:           "dev",
+		VisibilityTimeout: 60,
+		Environments: map[string]configEnvironment{
+			"prod": {Profile: "prod", Region: "us-east-1"},
+		},
+	}
+	parse := func(args ...string) cliFlags {
+		flags, err := parseFlags(args)
+		require.NoError(t, err)
+		// ignore the environment of whoever runs the tests
+		if !flags.changed["region"] {
+			flags.regionArg = ""
+		}
+		return flags
+	}
+
+	t.Run("defaults come from the config", func(t *testing.T) {
+		flags, err := applyConfig(parse("read"), cfg)
+
+		require.NoError(t, err)
+		assert.Equal(t, "eu-west-1", flags.regionArg)
+		assert.Equal(t, "dev", flags.profile)
+		assert.Equal(t, int64(60), flags.visibility)
+	})
+	t.Run("command line flags win", func(t *testing.T) {
+		flags, err := applyConfig(parse("read", "--region", "eu-west-2", "--profile", "me", "-t", "5"), cfg)
+
+		require.NoError(t, err)
+		assert.Equal(t, "eu-west-2", flags.regionArg)
+		assert.Equal(t, "me", flags.profile)
+		assert.Equal(t, int64(5), flags.visibility)
+	})
+	t.Run("a named environment replaces the defaults", func(t *testing.T) {
+		flags, err := applyConfig(parse("read", "--env", "prod"), cfg)
+
+		require.NoError(t, err)
+		assert.Equal(t, "us-east-1", flags.regionArg)
+		assert.Equal(t, "prod", flags.profile)
+	})
+	t.Run("an unknown environment is an error", func(t *testing.T) {
+		_, err := applyConfig(parse("read", "--env", "qa"), cfg)
+
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+type (
+	snapshotDiff struct {
+		Before    string   `json:"before"`
+		After     string   `json:"after"`
+		Added     []string `json:"added"`
+		Removed   []string `json:"removed"`
+		Changed   []string `json:"changed"`
+		Unchanged []string `json:"unchanged"`
+		// CountChange is after minus before for every custom attribute value whose count changed
+		CountChange        map[string]map[string]int `json:"customAttributeCountChange"`
+		MessageCountChange int                       `json:"messageCountChange"`
+	}
+)
+
+func diffSnapshots(w io.Writer, asJson bool, files []string) error {
+	if len(files) != 2 {
+		return errors.New("diff needs two result files, before and after")
+	}
+	before, err := readSnapshot(files[0])
+	if err != nil {
+		return err
+	}
+	after, err := readSnapshot(files[1])
+	if err != nil {
+		return err
+	}
+	diff := compareSnapshots(before, after)
+	diff.Before = files[0]
+	diff.After = files[1]
+	return writeSnapshotDiff(w, asJson, diff)
+}
+
+func readSnapshot(file string) (readQueueResult, error) {
+	var result readQueueResult
+	buf, err := ioutil.ReadFile(file)
+	if err != nil {
+		return result, err
+	}
+	if err := json.Unmarshal(buf, &result); err != nil {
+		return result, fmt.Errorf("failed reading %s: %v", file, err)
+	}
+	return result, nil
+}
+
+// compareSnapshots matches messages by MessageId, then anything left by a hash of body and custom attributes
+func compareSnapshots(before, after readQueueResult) snapshotDiff {
+	var diff snapshotDiff
+	byID := make(map[string]message)
+	for _, m := range before.Messages {
+		if m.MessageId != "" {
+			byID[m.MessageId] = m
+		}
+	}
+	matched := make(map[string]bool)
+	var unmatchedAfter []message
+	for _, m := range after.Messages {
+		b, ok := byID[m.MessageId]
+		if m.MessageId == "" || !ok {
+			unmatchedAfter = append(unmatchedAfter, m)
+			continue
+		}
+		matched[m.MessageId] = true
+		if contentHash(b) == contentHash(m) {
+			diff.Unchanged = append(diff.Unchanged, m.MessageId)
+		} else {
+			diff.Changed = append(diff.Changed, m.MessageId)
+		}
+	}
+	unmatchedBefore := make(map[string][]message)
+	for _, m := range before.Messages {
+		if m.MessageId == "" || !matched[m.MessageId] {
+			h := contentHash(m)
+			unmatchedBefore[h] = append(unmatchedBefore[h], m)
+		}
+	}
+	for _, m := range unmatchedAfter {
+		h := contentHash(m)
+		if candidates := unmatchedBefore[h]; len(candidates) > 0 {
+			unmatchedBefore[h] = candidates[1:]
+			diff.Unchanged = append(diff.Unchanged, messageRef(m))
+			continue
+		}
+		diff.Added = append(diff.Added, messageRef(m))
+	}
+	for _, remaining := range unmatchedBefore {
+		for _, m := range remaining {
+			diff.Removed = append(diff.Removed, messageRef(m))
+		}
+	}
+	for _, list := range [][]string{diff.Added, diff.Removed, diff.Changed, diff.Unchanged} {
+		sort.Strings(list)
+	}
+
+	var sumBefore, sumAfter summary
+	sumBefore.Add(before.Messages)
+	sumAfter.Add(after.Messages)
+	diff.MessageCountChange = sumAfter.MsgCount - sumBefore.MsgCount
+	diff.CountChange = attributeCountChange(sumBefore.MsgAttribs, sumAfter.MsgAttribs)
+	return diff
+}
+
+func attributeCountChange(before, after map[string]map[string]int) map[string]map[string]int {
+	change := make(map[string]map[string]int)
+	record := func(k, v string, delta int) {
+		if delta == 0 {
+			return
+		}
+		if change[k] == nil {
+			change[k] = make(map[string]int)
+		}
+		change[k][v] = delta
+	}
+	for k, values := range after {
+		for v, n := range values {
+			record(k, v, n-before[k][v])
+		}
+	}
+	for k, values := range before {
+		for v, n := range values {
+			if _, ok := after[k][v]; !ok {
+				record(k, v, -n)
+			}
+		}
+	}
+	return change
+}
+
+func contentHash(m message) string {
+	h := sha256.New()
+	_, _ = io.WriteString(h, m.Message.String())
+	keys := make([]string, 0, len(m.CustAttrib))
+	for k := range m.CustAttrib {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		_, _ = fmt.Fprintf(h, "\x00%s\x00%s", k, m.CustAttrib[k])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// messageRef names a message by id, or by content hash for results written before ids were recorded
+func messageRef(m message) string {
+	if m.MessageId != "" {
+		return m.MessageId
+	}
+	return "sha256:" + contentHash(m)[:12]
+}
+
+func writeSnapshotDiff(w io.Writer, asJson bool, diff snapshotDiff) error {
+	if asJson {
+		buf, err := jsonMarshal(diff)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(buf))
+		return err
+	}
+	_, _ = fmt.Fprintf(w, "added %d, removed %d, changed %d, unchanged %d, message count %+d\n",
+		len(diff.Added), len(diff.Removed), len(diff.Changed), len(diff.Unchanged), diff.MessageCountChange)
+	for _, group := range []struct {
+		mark string
+		ids  []string
+	}{{"+", diff.Added}, {"-", diff.Removed}, {"~", diff.Changed}} {
+		for _, id := range group.ids {
+			_, _ = fmt.Fprintf(w, "%s %s\n", group.mark, id)
+		}
+	}
+	var lines []string
+	for k, values := range diff.CountChange {
+		for v, n := range values {
+			lines = append(lines, fmt.Sprintf("  %s=%s %+d", k, v, n))
+		}
+	}
+	if len(lines) > 0 {
+		sort.Strings(lines)
+		_, _ = fmt.Fprintf(w, "custom attribute counts:\n%s\n", strings.Join(lines, "\n"))
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_snapshots_are_compared(t *testing.T) {
+	msg := func(id, body, finite string) message {
+		return message{MessageId: id, Message: flexiString(body), CustAttrib: map[string]string{"finite": finite}}
+	}
+	before := readQueueResult{Messages: []message{
+		msg("1", "a", "x"),
+		msg("2", "b", "x"),
+		msg("3", "c", "y"),
+		msg("", "old format", "y"),
+	}}
+	after := readQueueResult{Messages: []message{
+		msg("1", "a", "x"),
+		msg("3", "c changed", "y"),
+		msg("4", "d", "z"),
+		msg("", "old format", "y"),
+	}}
+
+	diff := compareSnapshots(before, after)
+
+	assert.Equal(t, []string{"4"}, diff.Added)
+	assert.Equal(t, []string{"2"}, diff.Removed)
+	assert.Equal(t, []string{"3"}, diff.Changed)
+	require.Len(t, diff.Unchanged, 2)
+	assert.Equal(t, "1", diff.Unchanged[0])
+	assert.Contains(t, diff.Unchanged[1], "sha256:")
+	assert.Equal(t, 0, diff.MessageCountChange)
+	assert.Equal(t, map[string]map[string]int{"finite": {"x": -1, "z": 1}}, diff.CountChange)
+
+	t.Run("the text report lists changes", func(t *testing.T) {
+		var buf bytes.Buffer
+
+		require.NoError(t, writeSnapshotDiff(&buf, false, diff))
+
+		assert.Equal(t, "added 1, removed 1, changed 1, unchanged 2, message count +0\n"+
+			"+ 4\n- 2\n~ 3\n"+
+			"custom attribute counts:\n  finite=x -1\n  finite=z +1\n", buf.String())
+	})
+}
+
+func Test_messages_without_ids_are_matched_by_content(t *testing.T) {
+	before := readQueueResult{Messages: []message{{Message: "same"}, {Message: "same"}}}
+	after := readQueueResult{Messages: []message{{Message: "same"}}}
+
+	diff := compareSnapshots(before, after)
+
+	assert.Len(t, diff.Unchanged, 1)
+	assert.Len(t, diff.Removed, 1)
+	assert.Equal(t, -1, diff.MessageCountChange)
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/NearlyUnique/awsqueue/queue"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+)
+
+type (
+	execOptions struct {
+		svc               sqsiface.SQSAPI
+		queueURL          string
+		command           []string
+		concurrency       int
+		timeout           time.Duration
+		visibilityTimeout int64
+		// envelope writes the whole message as json on stdin instead of the body and env vars
+		envelope bool
+		window   *queue.SentWindow
+		location *time.Location
+		ctx      context.Context
+	}
+	execCounts struct {
+		deleted  int64
+		released int64
+		mu       sync.Mutex
+		// failed is every MessageId the command failed for, they are not run again when received again
+		failed map[string]bool
+	}
+)
+
+// execMessages runs the command once per message, deleting on exit 0 and releasing otherwise.
+// Receiving stops once a batch holds only messages that already failed
+func execMessages(options execOptions) error {
+	if len(options.command) == 0 {
+		return errors.New("exec needs a command, e.g. awsqueue exec -f orders -- ./fix.sh")
+	}
+	if options.visibilityTimeout < 2 {
+		options.visibilityTimeout = 30
+	}
+	concurrency := options.concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	held := newVisibilityManager(options.svc, options.queueURL, options.visibilityTimeout)
+	stop := held.start(options.ctx)
+	defer stop()
+	readCtx, stopReading := context.WithCancel(options.ctx)
+	defer stopReading()
+	read := readQueueOptions{
+		svc:               options.svc,
+		queueURL:          options.queueURL,
+		visibilityTimeout: options.visibilityTimeout,
+		visibility:        held,
+		window:            options.window,
+		location:          options.location,
+		msg:               make(chan []message),
+		err:               make(chan error),
+		ctx:               readCtx,
+		wg:                &sync.WaitGroup{},
+	}
+	read.wg.Add(1)
+	go readQueueData(read)
+	received := signalWaitGroupDone(read.wg)
+
+	jobs := make(chan message)
+	var workers sync.WaitGroup
+	counts := execCounts{failed: make(map[string]bool)}
+	for i := 0; i < concurrency; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for m := range jobs {
+				options.handle(held, m, &counts)
+			}
+		}()
+	}
+
+	func() {
+		defer close(jobs)
+		for {
+			select {
+			case <-received:
+				return
+			case err := <-read.err:
+				if readCtx.Err() == nil {
+					_, _ = fmt.Fprintf(os.Stderr, "Error:%v\n", err)
+				}
+			case batch := <-read.msg:
+				batch, again := counts.split(batch)
+				if len(again) > 0 {
+					if err := held.release(context.Background(), again...); err != nil {
+						_, _ = fmt.Fprintf(os.Stderr, "Error:%v\n", err)
+					}
+					// failed messages come straight back, once only those are received every message has been tried
+					if len(batch) == 0 {
+						stopReading()
+					}
+				}
+				for _, m := range batch {
+					select {
+					case jobs <- m:
+					case <-options.ctx.Done():
+						// the visibility manager releases whatever is still held
+						return
+					}
+				}
+			}
+		}
+	}()
+	workers.Wait()
+
+	_, _ = fmt.Fprintf(os.Stderr, "deleted %d, released %d\n", counts.deleted, counts.released)
+	if options.ctx.Err() != nil {
+		return errors.New("stopped")
+	}
+	if counts.released > 0 {
+		return fmt.Errorf("the command failed for %d messages, they were released", counts.released)
+	}
+	return nil
+}
+
+func (options execOptions) handle(held *visibilityManager, m message, counts *execCounts) {
+	err := options.run(m)
+	if err != nil && options.ctx.Err() == nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Error %s: %v\n", m.MessageId, err)
+	}
+	if err == nil {
+		_, err = options.svc.DeleteMessageWithContext(context.Background(), &sqs.DeleteMessageInput{
+			QueueUrl:      aws.String(options.queueURL),
+			ReceiptHandle: m.Raw.ReceiptHandle,
+		})
+		if err == nil {
+			held.forget(m)
+			atomic.AddInt64(&counts.deleted, 1)
+			return
+		}
+		_, _ = fmt.Fprintf(os.Stderr, "Error deleting %s: %v\n", m.MessageId, err)
+	}
+	// recorded before it is released, so it is known when it is received again
+	counts.fail(m.MessageId)
+	if err := held.release(context.Background(), m); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Error releasing %s: %v\n", m.MessageId, err)
+	}
+	atomic.AddInt64(&counts.released, 1)
+}
+
+func (c *execCounts) fail(messageID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.failed[messageID] = true
+}
+
+// split separates messages the command already failed for
+func (c *execCounts) split(messages []message) (batch, again []message) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, m := range messages {
+		if c.failed[m.MessageId] {
+			again = append(again, m)
+		} else {
+			batch = append(batch, m)
+		}
+	}
+	return batch, again
+}
+
+func (options execOptions) run(m message) error {
+	ctx := options.ctx
+	if options.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, options.timeout)
+		defer cancel()
+	}
+	cmd := exec.Command(options.command[0], options.command[1:]...)
+	stdin, env, err := execInput(m, options.envelope)
+	if err != nil {
+		return err
+	}
+	cmd.Stdin = stdin
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	// its own process group, so a timeout also stops anything a script started
+	newProcessGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+	select {
+	case err = <-exited:
+		return err
+	case <-ctx.Done():
+		killProcessGroup(cmd)
+		<-exited
+		if ctx.Err() == context.DeadlineExceeded {
+			return fmt.Errorf("timed out after %v", options.timeout)
+		}
+		return ctx.Err()
+	}
+}
+
+// execInput is the body with attributes in AWSQUEUE_ATTR_<NAME> and AWSQUEUE_AWS_<NAME>, or the message as json
+func execInput(m message, envelope bool) (io.Reader, []string, error) {
+	env := []string{"AWSQUEUE_MESSAGE_ID=" + m.MessageId}
+	if envelope {
+		buf, err := jsonMarshal(m)
+		if err != nil {
+			return nil, nil, err
+		}
+		return bytes.NewReader(buf), env, nil
+	}
+	env = append(env, envVars("AWSQUEUE_ATTR_", m.CustAttrib)...)
+	env = append(env, envVars("AWSQUEUE_AWS_", m.AwsAttrib)...)
+	return strings.NewReader(m.Message.String()), env, nil
+}
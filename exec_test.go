@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/NearlyUnique/awsqueue/queue"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_exec_input(t *testing.T) {
+	m := message{
+		MessageId:   "m1",
+		CustAttrib:  map[string]string{"event-type": "created"},
+		AwsAttrib:   map[string]string{"ApproximateReceiveCount": "2"},
+		Message:     `{"id":1}`,
+		ContentType: queue.ContentTypeJSON,
+	}
+	t.Run("body with attributes as env vars", func(t *testing.T) {
+		stdin, env, err := execInput(m, false)
+		require.NoError(t, err)
+		body, _ := ioutil.ReadAll(stdin)
+		assert.Equal(t, `{"id":1}`, string(body))
+		assert.Equal(t, []string{
+			"AWSQUEUE_MESSAGE_ID=m1",
+			"AWSQUEUE_ATTR_EVENT_TYPE=created",
+			"AWSQUEUE_AWS_APPROXIMATERECEIVECOUNT=2",
+		}, env)
+	})
+	t.Run("json envelope", func(t *testing.T) {
+		stdin, env, err := execInput(m, true)
+		require.NoError(t, err)
+		var envelope map[string]interface{}
+		require.NoError(t, json.NewDecoder(stdin).Decode(&envelope))
+		assert.Equal(t, map[string]interface{}{"id": float64(1)}, envelope["message"])
+		assert.Equal(t, map[string]interface{}{"event-type": "created"}, envelope["customAttributes"])
+		assert.Equal(t, []string{"AWSQUEUE_MESSAGE_ID=m1"}, env)
+	})
+}
+
+func Test_running_the_exec_command(t *testing.T) {
+	m := message{MessageId: "m1", CustAttrib: map[string]string{"type": "created"}, Message: "hello"}
+	run := func(timeout time.Duration, script string) error {
+		return execOptions{command: []string{"sh", "-c", script}, timeout: timeout, ctx: context.Background()}.run(m)
+	}
+	assert.NoError(t, run(time.Second, `test "$(cat)" = hello && test "$AWSQUEUE_ATTR_TYPE" = created`))
+	assert.Error(t, run(time.Second, "exit 1"))
+	started := time.Now()
+	err := run(50*time.Millisecond, "sleep 5")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "timed out")
+	assert.True(t, time.Since(started) < 2*time.Second, "the shell and its sleep are both killed")
+}
+
+// fakeQueue hides each message it returns until it is deleted or its visibility is changed to 0
+type fakeQueue struct {
+	sqsiface.SQSAPI
+	mu       sync.Mutex
+	visible  []string
+	hidden   map[string]bool
+	receives int
+}
+
+func newFakeQueue(ids ...string) *fakeQueue {
+	return &fakeQueue{visible: ids, hidden: make(map[string]bool)}
+}
+
+func (f *fakeQueue) ReceiveMessageWithContext(_ aws.Context, _ *sqs.ReceiveMessageInput, _ ...request.Option) (*sqs.ReceiveMessageOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.receives++
+	out := &sqs.ReceiveMessageOutput{}
+	for _, id := range f.visible {
+		out.Messages = append(out.Messages, &sqs.Message{MessageId: aws.String(id), ReceiptHandle: aws.String(id), Body: aws.String("body")})
+		f.hidden[id] = true
+	}
+	f.visible = nil
+	return out, nil
+}
+
+func (f *fakeQueue) DeleteMessageWithContext(_ aws.Context, input *sqs.DeleteMessageInput, _ ...request.Option) (*sqs.DeleteMessageOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.hidden, aws.StringValue(input.ReceiptHandle))
+	return &sqs.DeleteMessageOutput{}, nil
+}
+
+func (f *fakeQueue) ChangeMessageVisibilityBatchWithContext(_ aws.Context, input *sqs.ChangeMessageVisibilityBatchInput, _ ...request.Option) (*sqs.ChangeMessageVisibilityBatchOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, e := range input.Entries {
+		id := aws.StringValue(e.ReceiptHandle)
+		if f.hidden[id] && aws.Int64Value(e.VisibilityTimeout) == 0 {
+			delete(f.hidden, id)
+			f.visible = append(f.visible, id)
+		}
+	}
+	return &sqs.ChangeMessageVisibilityBatchOutput{}, nil
+}
+
+func Test_exec_stops_when_the_command_always_fails(t *testing.T) {
+	runs, err := ioutil.TempFile("", "runs")
+	require.NoError(t, err)
+	_ = runs.Close()
+	defer func() { _ = os.Remove(runs.Name()) }()
+	fake := newFakeQueue("m1", "m2", "m3")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err = execMessages(execOptions{
+		svc:         fake,
+		queueURL:    "queue",
+		command:     []string{"sh", "-c", `echo "$AWSQUEUE_MESSAGE_ID" >> "$0"; exit 1`, runs.Name()},
+		concurrency: 2,
+		ctx:         ctx,
+	})
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed for 3 messages")
+	ran, err := ioutil.ReadFile(runs.Name())
+	require.NoError(t, err)
+	assert.Len(t, strings.Fields(string(ran)), 3, "a message received again after failing is not run again")
+	assert.Len(t, fake.visible, 3, "every failed message is released")
+	assert.Empty(t, fake.hidden)
+}
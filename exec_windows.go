@@ -0,0 +1,18 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"os/exec"
+	"strconv"
+)
+
+func newProcessGroup(*exec.Cmd) {}
+
+// killProcessGroup kills the command and its child processes
+func killProcessGroup(cmd *exec.Cmd) {
+	if err := exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(cmd.Process.Pid)).Run(); err != nil {
+		_ = cmd.Process.Kill()
+	}
+}
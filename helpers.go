@@ -1,14 +1,14 @@
 package main
 
 import (
-	"bytes"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"os"
 	"os/signal"
 	"sync"
 	"syscall"
+
+	"github.com/NearlyUnique/awsqueue/queue"
 )
 
 func registerForCtrlC(cancel func()) {
@@ -33,48 +33,64 @@ func signalWaitGroupDone(wg *sync.WaitGroup) chan struct{} {
 type CmdAction string
 
 const (
-	CmdActionList  CmdAction = "list"
-	CmdActionRead  CmdAction = "read"
-	CmdActionWrite CmdAction = "write"
+	CmdActionList     CmdAction = "list"
+	CmdActionRead     CmdAction = "read"
+	CmdActionWrite    CmdAction = "write"
+	CmdActionRestore  CmdAction = "restore"
+	CmdActionClone    CmdAction = "clone"
+	CmdActionSetAttrs CmdAction = "set-attributes"
+	CmdActionTopology CmdAction = "topology"
+	CmdActionCheck    CmdAction = "check"
+	CmdActionTag      CmdAction = "tag"
+	CmdActionPurge    CmdAction = "purge"
+	CmdActionBrowse   CmdAction = "browse"
+	CmdActionMetrics  CmdAction = "serve-metrics"
+	CmdActionDiff     CmdAction = "diff"
+	CmdActionMove     CmdAction = "move"
+	CmdActionRoute    CmdAction = "route"
+	CmdActionExec     CmdAction = "exec"
 )
 
 func cmdAction(fs cliFlags) (CmdAction, error) {
-	read := fs.read
-	write := fs.sendMsgSrc != ""
-	if read && write {
-		return "", errors.New("cannot specify both read and write")
+	if fs.action != "" {
+		return fs.action, nil
 	}
-	if read {
-		return CmdActionRead, nil
+	var actions []CmdAction
+	if fs.read || fs.archiveDir != "" {
+		actions = append(actions, CmdActionRead)
 	}
-	if write {
-		return CmdActionWrite, nil
+	if fs.sendMsgSrc != "" {
+		actions = append(actions, CmdActionWrite)
 	}
-	return CmdActionList, nil
-}
-
-type flexiString string
-
-func (fs flexiString) String() string {
-	return string(fs)
-}
-
-// MarshalJSON custom
-func (fs flexiString) MarshalJSON() ([]byte, error) {
-	buffer := bytes.NewBufferString("")
-	//buffer.WriteString("}")
-	if len(fs) >= 2 && fs[0] == '{' && fs[len(fs)-1] == '}' {
-		return []byte(fs), nil
+	if fs.restoreDir != "" {
+		actions = append(actions, CmdActionRestore)
 	}
-	s := string(fs)
-	buf, err := jsonMarshal(s)
-	if err != nil {
-		return nil, err
+	if fs.cloneTo != "" {
+		actions = append(actions, CmdActionClone)
 	}
-	_, err = buffer.Write(buf)
-	return buffer.Bytes(), err
+	if len(fs.setAttrs) > 0 {
+		actions = append(actions, CmdActionSetAttrs)
+	}
+	if fs.topology != "" {
+		actions = append(actions, CmdActionTopology)
+	}
+	if fs.check {
+		actions = append(actions, CmdActionCheck)
+	}
+	if len(fs.tagQueue) > 0 || len(fs.untagQueue) > 0 {
+		actions = append(actions, CmdActionTag)
+	}
+	switch len(actions) {
+	case 0:
+		return CmdActionList, nil
+	case 1:
+		return actions[0], nil
+	}
+	return "", fmt.Errorf("cannot specify both %s and %s", actions[0], actions[1])
 }
 
+type flexiString = queue.FlexiString
+
 func jsonMarshal(v interface{}) ([]byte, error) {
 	return json.MarshalIndent(v, "", "  ")
 }
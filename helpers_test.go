@@ -1,9 +1,9 @@
 package main
 
 import (
-	"encoding/json"
 	"testing"
 
+	"github.com/NearlyUnique/awsqueue/queue"
 	"github.com/aws/aws-sdk-go/service/sqs"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -15,7 +15,7 @@ func Test_resolve_single_queue(t *testing.T) {
 		result := QueueSearchResult{
 			Filter: "",
 			Attrs: at{
-				{AttrKeyQueueName: "one", AttrKeyQueueUrl: "http://any.com/1"},
+				{queue.AttrKeyQueueName: "one", queue.AttrKeyQueueUrl: "http://any.com/1"},
 			},
 		}
 		queueUrl, err := resolveQueueUrl(result, noInteraction)
@@ -27,8 +27,8 @@ func Test_resolve_single_queue(t *testing.T) {
 		result := QueueSearchResult{
 			Filter: "",
 			Attrs: at{
-				{AttrKeyQueueName: "one", AttrKeyQueueUrl: "http://any.com/1"},
-				{AttrKeyQueueName: "two", AttrKeyQueueUrl: "http://any.com/2"},
+				{queue.AttrKeyQueueName: "one", queue.AttrKeyQueueUrl: "http://any.com/1"},
+				{queue.AttrKeyQueueName: "two", queue.AttrKeyQueueUrl: "http://any.com/2"},
 			},
 		}
 		queueUrl, err := resolveQueueUrl(result, noInteraction)
@@ -41,8 +41,8 @@ func Test_resolve_single_queue(t *testing.T) {
 			Filter:      "one",
 			AllMessages: true,
 			Attrs: at{
-				{AttrKeyQueueName: "oneTwo", AttrKeyQueueUrl: "http://any.com/1"},
-				{AttrKeyQueueName: "one", AttrKeyQueueUrl: "http://any.com/2"},
+				{queue.AttrKeyQueueName: "oneTwo", queue.AttrKeyQueueUrl: "http://any.com/1"},
+				{queue.AttrKeyQueueName: "one", queue.AttrKeyQueueUrl: "http://any.com/2"},
 			},
 		}
 		queueUrl, err := resolveQueueUrl(result, noInteraction)
@@ -55,8 +55,8 @@ func Test_resolve_single_queue(t *testing.T) {
 			Filter:      "submatch",
 			AllMessages: false,
 			Attrs: at{
-				{AttrKeyQueueName: "xsubmatch1", AttrKeyQueueUrl: "http://any.com/name1", sqs.QueueAttributeNameApproximateNumberOfMessages: "1"},
-				{AttrKeyQueueName: "xsubmatch2", AttrKeyQueueUrl: "http://any.com/name2", sqs.QueueAttributeNameApproximateNumberOfMessages: "0"},
+				{queue.AttrKeyQueueName: "xsubmatch1", queue.AttrKeyQueueUrl: "http://any.com/name1", sqs.QueueAttributeNameApproximateNumberOfMessages: "1"},
+				{queue.AttrKeyQueueName: "xsubmatch2", queue.AttrKeyQueueUrl: "http://any.com/name2", sqs.QueueAttributeNameApproximateNumberOfMessages: "0"},
 			},
 		}
 		queueUrl, err := resolveQueueUrl(result, noInteraction)
@@ -66,6 +66,21 @@ func Test_resolve_single_queue(t *testing.T) {
 	})
 }
 
+func Test_changes_are_only_confirmed_by_the_user_or_yes(t *testing.T) {
+	t.Run("yes agrees without asking", func(t *testing.T) {
+		ok, err := confirm("Delete every message in the queue?", noInteraction, true)
+
+		require.NoError(t, err)
+		assert.True(t, ok)
+	})
+	t.Run("no interaction without yes is an error", func(t *testing.T) {
+		ok, err := confirm("Delete every message in the queue?", noInteraction, false)
+
+		assert.EqualError(t, err, "Delete every message in the queue needs --yes with --no-interaction")
+		assert.False(t, ok)
+	})
+}
+
 func Test_command_action_is_determined_from_flags(t *testing.T) {
 	t.Run("when no flags, default is list", func(t *testing.T) {
 		fs, err := parseFlags([]string{})
@@ -104,24 +119,38 @@ func Test_command_action_is_determined_from_flags(t *testing.T) {
 	})
 }
 
-func Test_flexistring_json_marshalling(t *testing.T) {
-	type testType struct {
-		Value flexiString
-	}
-	t.Run("a basic string comes out as text", func(t *testing.T) {
-		fs := testType{`some text`}
+func Test_subcommands_determine_the_action(t *testing.T) {
+	t.Run("a subcommand sets the action", func(t *testing.T) {
+		fs, err := parseFlags([]string{"read", "-f", "orders", "--archive", "dir"})
+		require.NoError(t, err)
 
-		buf, err := json.Marshal(fs)
+		cmd, err := cmdAction(fs)
 
 		require.NoError(t, err)
-		assert.Equal(t, string(buf), `{"Value":"some text"}`)
+		assert.Equal(t, CmdActionRead, cmd)
+		assert.Equal(t, "orders", fs.filter)
+		assert.Equal(t, "dir", fs.archiveDir)
 	})
-	t.Run("when the string looks like a json object it is treated as such", func(t *testing.T) {
-		fs := testType{`{"some":true}`}
+	t.Run("subcommand flags map to the same options as the deprecated flags", func(t *testing.T) {
+		fs, err := parseFlags([]string{"send", "--source", "result.json", "--rate", "5/s"})
+		require.NoError(t, err)
+		legacy, err := parseFlags([]string{"--write-source", "result.json", "--rate", "5/s"})
+		require.NoError(t, err)
 
-		buf, err := json.Marshal(fs)
+		cmd, err := cmdAction(fs)
+		require.NoError(t, err)
+		legacyCmd, err := cmdAction(legacy)
+		require.NoError(t, err)
 
+		assert.Equal(t, legacyCmd, cmd)
+		assert.Equal(t, legacy.sendMsgSrc, fs.sendMsgSrc)
+		assert.Equal(t, legacy.rate, fs.rate)
+	})
+	t.Run("topology defaults to text", func(t *testing.T) {
+		fs, err := parseFlags([]string{"topology"})
 		require.NoError(t, err)
-		assert.Equal(t, string(buf), `{"Value":{"some":true}}`)
+
+		assert.Equal(t, CmdActionTopology, fs.action)
+		assert.Equal(t, TopologyText, fs.topology)
 	})
 }
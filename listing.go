@@ -4,83 +4,95 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"log"
+	"io"
 	"os"
+	"sort"
+	"strconv"
 	"strings"
-	"sync"
+	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
+	"github.com/NearlyUnique/awsqueue/queue"
 	"github.com/aws/aws-sdk-go/service/sqs"
 )
 
-type listQueueOptions struct {
-	svc         *sqs.SQS
-	filter      string
-	allMessages bool
-	ctx         context.Context
-}
-
-func listQueues(options listQueueOptions) (QueueSearchResult, error) {
-	list, err := options.svc.ListQueues(nil)
-	if err != nil {
-		return QueueSearchResult{}, err
-	}
-	result := readQueueAttrs(options, list)
-	return result, nil
-}
+const (
+	SortByName     = "name"
+	SortByVisible  = "visible"
+	SortByInFlight = "inflight"
+	SortByCreated  = "created"
+	SortByModified = "modified"
 
-func readQueueAttrs(options listQueueOptions, list *sqs.ListQueuesOutput) QueueSearchResult {
-	var wg sync.WaitGroup
-	ch := make(chan map[string]flexiString)
+	ColumnVisible  = "visible"
+	ColumnInFlight = "inflight"
+	ColumnDelayed  = "delayed"
+	ColumnCreated  = "created"
+	ColumnAge      = "age"
+	ColumnModified = "modified"
+)
 
-	results := QueueSearchResult{
-		Filter: options.filter,
+type (
+	QueueSearchResult = queue.SearchResult
+	listQueueOptions  struct {
+		svc         *sqs.SQS
+		filter      string
+		tags        map[string]string
+		allMessages bool
+		location    *time.Location
+		ctx         context.Context
+	}
+	// listFormat controls the order and columns of printList, the zero value sorts by name
+	listFormat struct {
+		asJson  bool
+		sortBy  string
+		desc    bool
+		top     int
+		columns []string
+	}
+	listColumn struct {
+		header string
+		attr   string
+		width  int
 	}
+)
 
-	for _, q := range list.QueueUrls {
-		if results.matchesFilter(*q) {
-			wg.Add(1)
-			go func(q string) {
-				defer wg.Done()
-				attrQuery := sqs.GetQueueAttributesInput{
-					QueueUrl:       &q,
-					AttributeNames: []*string{aws.String(sqs.QueueAttributeNameAll)},
-				}
+var listSortKeys = map[string]string{
+	SortByName:     queue.AttrKeyQueueName,
+	SortByVisible:  sqs.QueueAttributeNameApproximateNumberOfMessages,
+	SortByInFlight: sqs.QueueAttributeNameApproximateNumberOfMessagesNotVisible,
+	SortByCreated:  sqs.QueueAttributeNameCreatedTimestamp,
+	SortByModified: sqs.QueueAttributeNameLastModifiedTimestamp,
+}
 
-				attr, err := options.svc.GetQueueAttributes(&attrQuery)
-				if err != nil {
-					_, _ = fmt.Fprintf(os.Stderr, "Failed at: %v\n", q)
-					log.Fatal(err)
-				}
-				parts := strings.Split(q, "/")
-				attrs := map[string]flexiString{
-					AttrKeyQueueUrl:  flexiString(q),
-					AttrKeyQueueName: flexiString(parts[len(parts)-1]),
-				}
-				for key, value := range attr.Attributes {
-					if ok, ts := isTimestamp(key, *value); ok {
-						attrs["_"+key] = flexiString(formatTimestamp(ts))
-					}
-					attrs[key] = flexiString(*value)
-				}
-				ch <- attrs
-			}(*q)
-		}
-	}
-	go func() {
-		wg.Wait()
-		close(ch)
-	}()
+var listColumns = map[string]listColumn{
+	ColumnVisible:  {"VISIBLE", sqs.QueueAttributeNameApproximateNumberOfMessages, 5},
+	ColumnInFlight: {"INFLIGHT", sqs.QueueAttributeNameApproximateNumberOfMessagesNotVisible, 8},
+	ColumnDelayed:  {"DELAYED", sqs.QueueAttributeNameApproximateNumberOfMessagesDelayed, 7},
+	ColumnCreated:  {"CREATED", "_" + sqs.QueueAttributeNameCreatedTimestamp, 23},
+	ColumnAge:      {"AGE", "_" + sqs.QueueAttributeNameCreatedTimestamp + queue.AgeSuffix, 11},
+	ColumnModified: {"MODIFIED", "_" + sqs.QueueAttributeNameLastModifiedTimestamp + queue.AgeSuffix, 11},
+}
+
+func listQueues(options listQueueOptions) (QueueSearchResult, error) {
+	return queue.List(options.ctx, options.svc, options.queueListOptions())
+}
 
-	results.AllMessages = options.allMessages
-	for a := range ch {
-		results.Attrs = append(results.Attrs, a)
+func (options listQueueOptions) queueListOptions() queue.ListOptions {
+	return queue.ListOptions{
+		Filter:      options.filter,
+		Tags:        options.tags,
+		AllMessages: options.allMessages,
+		Warn: func(err error) {
+			_, _ = fmt.Fprintf(os.Stderr, "%v\n", err)
+		},
+		Location: options.location,
 	}
+}
 
-	return results
+func printList(format listFormat, result QueueSearchResult) error {
+	return writeList(os.Stdout, format, result)
 }
 
-func printList(asJson bool, result QueueSearchResult) error {
+func writeList(w io.Writer, format listFormat, result QueueSearchResult) error {
 	if !result.AllMessages {
 		for i := 0; i < len(result.Attrs); i++ {
 			if result.Attrs[i][sqs.QueueAttributeNameApproximateNumberOfMessages] == "0" {
@@ -89,46 +101,91 @@ func printList(asJson bool, result QueueSearchResult) error {
 			}
 		}
 	}
-	if asJson {
+	if err := sortQueues(result.Attrs, format.sortBy, format.desc); err != nil {
+		return err
+	}
+	if format.top > 0 && len(result.Attrs) > format.top {
+		result.Attrs = result.Attrs[:format.top]
+	}
+	if format.asJson {
 		buf, err := jsonMarshal(result)
 		if err != nil {
 			return errors.New(fmt.Sprintf("failed marshalling json: %v\n", err))
 		}
-		fmt.Println(string(buf))
+		_, _ = fmt.Fprintln(w, string(buf))
 		return nil
 	}
+	columns, err := selectColumns(format.columns)
+	if err != nil {
+		return err
+	}
+	// timestamps with a --tz offset are wider than the default format
+	for i, c := range columns {
+		for _, attr := range result.Attrs {
+			if n := len(attr[c.attr]); n > c.width {
+				columns[i].width = n
+			}
+		}
+	}
+	// the default count column keeps the original headerless output, chosen columns are labelled
+	if len(format.columns) > 0 {
+		for _, c := range columns {
+			_, _ = fmt.Fprintf(w, "%-*s ", c.width, c.header)
+		}
+		_, _ = fmt.Fprintln(w, "NAME")
+	}
 	for _, attr := range result.Attrs {
-		fmt.Printf("%5s %s\n", attr[sqs.QueueAttributeNameApproximateNumberOfMessages], attr[AttrKeyQueueName])
+		for _, c := range columns {
+			if c.attr[0] == '_' {
+				_, _ = fmt.Fprintf(w, "%-*s ", c.width, attr[c.attr])
+			} else {
+				_, _ = fmt.Fprintf(w, "%*s ", c.width, attr[c.attr])
+			}
+		}
+		_, _ = fmt.Fprintf(w, "%s%s\n", attr[queue.AttrKeyQueueName], formatTags(queue.TagsOf(attr)))
 	}
 	return nil
 }
 
-func (result QueueSearchResult) matchesFilter(queue string) bool {
-	return result.Filter == "" || strings.Contains(strings.ToLower(queue), strings.ToLower(result.Filter))
-}
-
-func (result QueueSearchResult) filteredQueues() []map[string]flexiString {
-	//if len(result.Attrs) == 1 {
-	//	// one match, all good
-	//	return result.Attrs[:1]
-	//}
-	var filtered []map[string]flexiString
-	for _, attr := range result.Attrs {
-		hasMessages := attr[sqs.QueueAttributeNameApproximateNumberOfMessages] != "0" && attr[sqs.QueueAttributeNameApproximateNumberOfMessages] != ""
-		if (result.AllMessages || (!result.AllMessages && hasMessages)) &&
-			result.matchesFilter(attr[AttrKeyQueueName].String()) {
-			filtered = append(filtered, attr)
+// sortQueues orders by the chosen key then by name, counts and timestamps compare as numbers
+func sortQueues(queues []map[string]flexiString, sortBy string, desc bool) error {
+	if sortBy == "" {
+		sortBy = SortByName
+	}
+	key, ok := listSortKeys[sortBy]
+	if !ok {
+		return fmt.Errorf("cannot sort by %q, use one of name, visible, inflight, created or modified", sortBy)
+	}
+	less := func(a, b map[string]flexiString) bool {
+		if key != queue.AttrKeyQueueName {
+			x, _ := strconv.ParseInt(a[key].String(), 10, 64)
+			y, _ := strconv.ParseInt(b[key].String(), 10, 64)
+			if x != y {
+				return x < y
+			}
 		}
+		return a[queue.AttrKeyQueueName] < b[queue.AttrKeyQueueName]
 	}
-	return filtered
+	sort.SliceStable(queues, func(i, j int) bool {
+		if desc {
+			return less(queues[j], queues[i])
+		}
+		return less(queues[i], queues[j])
+	})
+	return nil
 }
-func (result QueueSearchResult) exactMatch() map[string]flexiString {
-	// exact match across any Queue?
-	for _, attr := range result.Attrs {
-		if strings.EqualFold(result.Filter, attr[AttrKeyQueueName].String()) {
-			// several matches but an exact (case insensitive) match, all good
-			return attr
+
+func selectColumns(names []string) ([]listColumn, error) {
+	if len(names) == 0 {
+		names = []string{ColumnVisible}
+	}
+	var columns []listColumn
+	for _, name := range names {
+		c, ok := listColumns[strings.ToLower(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown column %q, use any of visible, inflight, delayed, created, age, modified", name)
 		}
+		columns = append(columns, c)
 	}
-	return nil
+	return columns, nil
 }
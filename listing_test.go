@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/NearlyUnique/awsqueue/queue"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func listingQueue(name, visible, inFlight, created string) map[string]flexiString {
+	return map[string]flexiString{
+		queue.AttrKeyQueueName:                                         flexiString(name),
+		sqs.QueueAttributeNameApproximateNumberOfMessages:              flexiString(visible),
+		sqs.QueueAttributeNameApproximateNumberOfMessagesNotVisible:    flexiString(inFlight),
+		sqs.QueueAttributeNameApproximateNumberOfMessagesDelayed:       "0",
+		sqs.QueueAttributeNameCreatedTimestamp:                         flexiString(created),
+		"_" + sqs.QueueAttributeNameCreatedTimestamp:                   "2019-11-19 09:10:12.000",
+		"_" + sqs.QueueAttributeNameCreatedTimestamp + queue.AgeSuffix: "3h12m ago",
+	}
+}
+
+func listingNames(queues []map[string]flexiString) []string {
+	var names []string
+	for _, q := range queues {
+		names = append(names, q[queue.AttrKeyQueueName].String())
+	}
+	return names
+}
+
+func Test_sorting_queues(t *testing.T) {
+	queues := func() []map[string]flexiString {
+		return []map[string]flexiString{
+			listingQueue("orders", "9", "1", "1574154612"),
+			listingQueue("billing", "10", "1", "1574154600"),
+			listingQueue("audit", "9", "5", "1574154700"),
+		}
+	}
+	t.Run("by name when not given", func(t *testing.T) {
+		q := queues()
+		require.NoError(t, sortQueues(q, "", false))
+		assert.Equal(t, []string{"audit", "billing", "orders"}, listingNames(q))
+	})
+	t.Run("counts compare as numbers then by name", func(t *testing.T) {
+		q := queues()
+		require.NoError(t, sortQueues(q, SortByVisible, false))
+		assert.Equal(t, []string{"audit", "orders", "billing"}, listingNames(q))
+	})
+	t.Run("descending", func(t *testing.T) {
+		q := queues()
+		require.NoError(t, sortQueues(q, SortByInFlight, true))
+		assert.Equal(t, []string{"audit", "orders", "billing"}, listingNames(q))
+	})
+	t.Run("by creation time", func(t *testing.T) {
+		q := queues()
+		require.NoError(t, sortQueues(q, SortByCreated, false))
+		assert.Equal(t, []string{"billing", "orders", "audit"}, listingNames(q))
+	})
+	t.Run("unknown key", func(t *testing.T) {
+		assert.Error(t, sortQueues(queues(), "size", false))
+	})
+}
+
+func Test_writing_the_list(t *testing.T) {
+	result := func() QueueSearchResult {
+		return QueueSearchResult{Attrs: []map[string]flexiString{
+			listingQueue("orders", "9", "1", "1574154612"),
+			listingQueue("empty", "0", "0", "1574154612"),
+			listingQueue("billing", "10", "2", "1574154600"),
+		}}
+	}
+	t.Run("default output is unchanged apart from the order", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, writeList(&buf, listFormat{}, result()))
+		assert.Equal(t, "   10 billing\n    9 orders\n", buf.String())
+	})
+	t.Run("top after sorting", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, writeList(&buf, listFormat{sortBy: SortByVisible, desc: true, top: 1}, result()))
+		assert.Equal(t, "   10 billing\n", buf.String())
+	})
+	t.Run("extra columns get a header", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, writeList(&buf, listFormat{columns: []string{"inflight", "delayed", "created"}, top: 1}, result()))
+		assert.Equal(t, ""+
+			"INFLIGHT DELAYED CREATED                 NAME\n"+
+			"       2       0 2019-11-19 09:10:12.000 billing\n", buf.String())
+	})
+	t.Run("a single chosen column gets a header too", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, writeList(&buf, listFormat{columns: []string{"inflight"}, top: 1}, result()))
+		assert.Equal(t, "INFLIGHT NAME\n       2 billing\n", buf.String())
+	})
+	t.Run("ages and wider timestamps", func(t *testing.T) {
+		queues := result()
+		queues.Attrs[2]["_"+sqs.QueueAttributeNameCreatedTimestamp] = "2019-11-19T10:10:12+01:00"
+		var buf bytes.Buffer
+		require.NoError(t, writeList(&buf, listFormat{columns: []string{"created", "age"}, top: 1}, queues))
+		assert.Equal(t, ""+
+			"CREATED                   AGE         NAME\n"+
+			"2019-11-19T10:10:12+01:00 3h12m ago   billing\n", buf.String())
+	})
+	t.Run("unknown column", func(t *testing.T) {
+		assert.Error(t, writeList(&bytes.Buffer{}, listFormat{columns: []string{"size"}}, result()))
+	})
+}
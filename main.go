@@ -7,9 +7,13 @@ import (
 	"os"
 	"strings"
 	"sync"
+	"time"
 
+	"github.com/NearlyUnique/awsqueue/queue"
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
 	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
 	"github.com/aws/aws-sdk-go/service/sqs"
 	"github.com/vito/go-interact/interact"
 )
@@ -18,21 +22,14 @@ var version = "0.0.0"
 var commit = ""
 var date = ""
 
-type QueueSearchResult struct {
-	Filter      string                   `json:"filter"`
-	AllMessages bool                     `json:"allMessages"`
-	Attrs       []map[string]flexiString `json:"awsAttributes"`
-}
-
-const (
-	AttrKeyQueueUrl  = "_Url"
-	AttrKeyQueueName = "_Name"
-)
-
 func main() {
 	if err := _main(); err != nil {
 		_, _ = fmt.Fprintln(os.Stderr, err.Error())
-		os.Exit(1)
+		var exit exitCodeError
+		if errors.As(err, &exit) {
+			os.Exit(exit.code)
+		}
+		os.Exit(ExitCodeError)
 	}
 }
 
@@ -45,64 +42,324 @@ func _main() error {
 		fmt.Printf("%s %s %s\n", version, commit, date)
 		return nil
 	}
-
-	if flags.regionArg == "" {
-		flags.regionArg = "eu-west-1"
+	// without --tz timestamps are in local time without an offset
+	var location *time.Location
+	if flags.tz != "" {
+		if location, err = queue.ParseLocation(flags.tz); err != nil {
+			return err
+		}
+	}
+	if flags.action == CmdActionDiff {
+		return diffSnapshots(os.Stdout, flags.asJson, flags.args)
 	}
-	sess, err := session.NewSession(&aws.Config{Region: aws.String(flags.regionArg)})
+
+	cfg, err := loadConfig(configPaths(flags.configFile)...)
 	if err != nil {
 		return err
 	}
+	if flags, err = applyConfig(flags, cfg); err != nil {
+		return err
+	}
 	action, err := cmdAction(flags)
 	if err != nil {
 		return err
 	}
+	if url := aliasURL(flags, action); url != "" {
+		flags.queueURL = url
+		flags.filter = ""
+	}
+	ref, err := parseQueueRef(flags.queueURL, flags.queueName, flags.ownerAccount)
+	if err != nil {
+		return err
+	}
+	if ref.region != "" && !flags.changed["region"] {
+		flags.regionArg = ref.region
+	}
+	if flags.regionArg == "" {
+		flags.regionArg = "eu-west-1"
+	}
+	sess, err := newSession(flags.regionArg, flags)
+	if err != nil {
+		return err
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	registerForCtrlC(cancel)
 
 	svc := sqs.New(sess)
-	result, err := listQueues(listQueueOptions{
+	listOptions := listQueueOptions{
 		svc:         svc,
 		filter:      flags.filter,
+		tags:        flags.tags,
 		allMessages: flags.allMessages,
+		location:    location,
 		ctx:         ctx,
-	})
-	if err != nil {
-		return err
+	}
+	if action == CmdActionBrowse {
+		return browse(browseOptions{
+			svc:        svc,
+			list:       listOptions,
+			visibility: flags.visibility,
+			ctx:        ctx,
+		})
+	}
+	if action == CmdActionMetrics {
+		return serveMetrics(metricsOptions{
+			list:          listOptions,
+			region:        flags.regionArg,
+			listen:        flags.listen,
+			cacheInterval: flags.cacheInterval,
+			ctx:           ctx,
+		})
+	}
+	var result QueueSearchResult
+	var queueURL string
+	if ref.isSet() {
+		if queueURL, err = ref.resolve(ctx, svc); err != nil {
+			return err
+		}
+		if needsQueueAttrs(action, flags.archiveDir != "") {
+			if result, err = describeQueue(listOptions, queueURL); err != nil {
+				return err
+			}
+		}
+	} else if action == CmdActionTopology {
+		if result, err = listTopology(listOptions); err != nil {
+			return err
+		}
+	} else {
+		if result, err = listQueues(listOptions); err != nil {
+			return err
+		}
 	}
 	if action == CmdActionList {
-		return printList(flags.asJson, result)
+		format := listFormat{
+			asJson: flags.asJson,
+			sortBy: flags.sortBy,
+			desc:   flags.desc,
+			top:    flags.top,
+		}
+		// only columns given on the command line get a header
+		if flags.changed["columns"] {
+			format.columns = flags.columns
+		}
+		return printList(format, result)
+	}
+	if action == CmdActionTopology {
+		return printTopology(os.Stdout, flags.topology, buildTopology(result))
+	}
+	if action == CmdActionCheck {
+		rules, err := checkRules(flags)
+		if err != nil {
+			return err
+		}
+		return checkQueues(checkOptions{
+			metrics: cloudwatch.New(sess),
+			rules:   rules,
+			asJson:  flags.asJson,
+			out:     os.Stdout,
+			ctx:     ctx,
+		}, result)
 	}
 
-	queueURL, err := resolveQueueUrl(result, interactionType(flags.noInteraction))
+	window, err := sentWindow(flags.sentAfter, flags.sentBefore, time.Now(), location)
 	if err != nil {
 		return err
 	}
 
+	if action == CmdActionRead && flags.multi {
+		if ref.isSet() {
+			return errors.New("cannot specify both --multi and a single queue")
+		}
+		return readQueues(readQueueOptions{
+			svc:               svc,
+			visibilityTimeout: flags.visibility,
+			maxUnique:         flags.maxUnique,
+			archiveDir:        flags.archiveDir,
+			window:            window,
+			location:          location,
+			ctx:               ctx,
+		}, result.FilteredQueues())
+	}
+	if queueURL == "" {
+		if queueURL, err = resolveQueueUrl(result, interactionType(flags.noInteraction)); err != nil {
+			return err
+		}
+	}
+
 	switch action {
 	case CmdActionRead:
-		readMessages(readQueueOptions{
+		return readMessages(readQueueOptions{
 			svc:               svc,
 			queueURL:          queueURL,
 			visibilityTimeout: flags.visibility,
 			maxUnique:         flags.maxUnique,
+			archiveDir:        flags.archiveDir,
+			queueAttrs:        result.AttrsFor(queueURL),
+			window:            window,
+			location:          location,
 			ctx:               ctx,
 			msg:               make(chan []message),
 			err:               make(chan error),
 			wg:                &sync.WaitGroup{},
 		})
 	case CmdActionWrite:
-		sendMessages(sendOptions{
+		rate, err := parseRate(flags.rate)
+		if err != nil {
+			return err
+		}
+		transform, err := newTransform(flags.transform)
+		if err != nil {
+			return err
+		}
+		return sendMessages(sendOptions{
+			svc:         svc,
+			queueURL:    queueURL,
+			source:      flags.sendMsgSrc,
+			rate:        rate,
+			burst:       flags.burst,
+			concurrency: flags.concurrency,
+			transform:   transform,
+			dryRun:      flags.dryRun,
+			preview:     flags.preview,
+			ctx:         ctx,
+		})
+	case CmdActionMove:
+		target, targetURL, err := moveTarget(ctx, flags)
+		if err != nil {
+			return err
+		}
+		transform, err := newTransform(flags.transform)
+		if err != nil {
+			return err
+		}
+		return moveMessages(moveOptions{
+			source:            svc,
+			sourceURL:         queueURL,
+			target:            target,
+			targetURL:         targetURL,
+			deleteSource:      flags.deleteSource,
+			journal:           flags.journal,
+			visibilityTimeout: flags.visibility,
+			transform:         transform,
+			dryRun:            flags.dryRun,
+			preview:           flags.preview,
+			window:            window,
+			location:          location,
+			ctx:               ctx,
+		})
+	case CmdActionRoute:
+		table, err := loadRoutes(flags.routesFile)
+		if err != nil {
+			return err
+		}
+		return routeMessages(routeOptions{
+			svc:               svc,
+			queueURL:          queueURL,
+			table:             table,
+			visibilityTimeout: flags.visibility,
+			dryRun:            flags.dryRun,
+			location:          location,
+			ctx:               ctx,
+		})
+	case CmdActionExec:
+		return execMessages(execOptions{
+			svc:               svc,
+			queueURL:          queueURL,
+			command:           flags.args,
+			concurrency:       flags.concurrency,
+			timeout:           flags.timeout,
+			visibilityTimeout: flags.visibility,
+			envelope:          flags.envelope,
+			window:            window,
+			location:          location,
+			ctx:               ctx,
+		})
+	case CmdActionRestore:
+		return restoreArchive(restoreOptions{
+			svc:      svc,
 			queueURL: queueURL,
+			dir:      flags.restoreDir,
 			ctx:      ctx,
-			svc:      svc,
-			err:      make(chan error, 10),
+		})
+	case CmdActionClone:
+		target := svc
+		if flags.cloneRegion != "" && flags.cloneRegion != flags.regionArg {
+			targetSess, err := newSession(flags.cloneRegion, flags)
+			if err != nil {
+				return err
+			}
+			target = sqs.New(targetSess)
+		}
+		return cloneQueue(cloneOptions{
+			svc:         svc,
+			target:      target,
+			queueURL:    queueURL,
+			queueAttrs:  result.AttrsFor(queueURL),
+			name:        flags.cloneTo,
+			dryRun:      flags.dryRun,
+			interaction: interactionType(flags.noInteraction),
+			yes:         flags.yes,
+			ctx:         ctx,
+		})
+	case CmdActionTag:
+		return tagQueue(tagOptions{
+			svc:         svc,
+			queueURL:    queueURL,
+			tag:         flags.tagQueue,
+			untag:       flags.untagQueue,
+			dryRun:      flags.dryRun,
+			interaction: interactionType(flags.noInteraction),
+			yes:         flags.yes,
+			ctx:         ctx,
+		})
+	case CmdActionPurge:
+		return purgeQueue(purgeOptions{
+			svc:         svc,
+			queueURL:    queueURL,
+			dryRun:      flags.dryRun,
+			interaction: interactionType(flags.noInteraction),
+			yes:         flags.yes,
+			ctx:         ctx,
+		})
+	case CmdActionSetAttrs:
+		if len(flags.setAttrs) == 0 {
+			return printList(listFormat{asJson: true}, QueueSearchResult{
+				Filter:      result.Filter,
+				AllMessages: true,
+				Attrs:       []map[string]flexiString{result.AttrsFor(queueURL)},
+			})
+		}
+		return setQueueAttributes(setAttributesOptions{
+			svc:         svc,
+			queueURL:    queueURL,
+			queueAttrs:  result.AttrsFor(queueURL),
+			set:         flags.setAttrs,
+			dryRun:      flags.dryRun,
+			interaction: interactionType(flags.noInteraction),
+			yes:         flags.yes,
+			ctx:         ctx,
 		})
 	}
 	return nil
 }
 
+func newSession(region string, flags cliFlags) (*session.Session, error) {
+	cfg := aws.Config{Region: aws.String(region)}
+	if flags.endpoint != "" {
+		cfg.Endpoint = aws.String(flags.endpoint)
+	}
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config:            cfg,
+		Profile:           flags.profile,
+		SharedConfigState: session.SharedConfigEnable,
+	})
+	if err != nil || flags.role == "" {
+		return sess, err
+	}
+	return sess.Copy(&aws.Config{Credentials: stscreds.NewCredentials(sess, flags.role)}), nil
+}
+
 type (
 	interactionType bool
 )
@@ -112,23 +369,24 @@ const (
 	allowInteraction interactionType = false
 )
 
+// resolveQueueUrl asks when the filter matches several queues
 func resolveQueueUrl(result QueueSearchResult, interaction interactionType) (string, error) {
-	filtered := result.filteredQueues()
+	filtered := result.FilteredQueues()
 	var queueURL string
 	switch l := len(filtered); {
 	case l == 1:
-		queueURL = filtered[0][AttrKeyQueueUrl].String()
+		queueURL = filtered[0][queue.AttrKeyQueueUrl].String()
 	case l > 1:
 		var list []interact.Choice
 		for _, attr := range filtered {
 			// exact match
-			if strings.EqualFold(result.Filter, attr[AttrKeyQueueName].String()) {
-				return attr[AttrKeyQueueUrl].String(), nil
+			if strings.EqualFold(result.Filter, attr[queue.AttrKeyQueueName].String()) {
+				return attr[queue.AttrKeyQueueUrl].String(), nil
 			}
 			list = append(list,
 				interact.Choice{
-					Display: fmt.Sprintf("%5s %s", attr[sqs.QueueAttributeNameApproximateNumberOfMessages], attr[AttrKeyQueueName]),
-					Value:   attr[AttrKeyQueueUrl].String(),
+					Display: fmt.Sprintf("%5s %s", attr[sqs.QueueAttributeNameApproximateNumberOfMessages], attr[queue.AttrKeyQueueName]),
+					Value:   attr[queue.AttrKeyQueueUrl].String(),
 				})
 		}
 		if interaction == noInteraction {
@@ -145,3 +403,17 @@ func resolveQueueUrl(result QueueSearchResult, interaction interactionType) (str
 	}
 	return queueURL, nil
 }
+
+// confirm asks the user to agree before making a change, yes agrees up front.
+// Without interaction and yes it is an error, a script should not change a queue it was not told to
+func confirm(prompt string, interaction interactionType, yes bool) (bool, error) {
+	if yes {
+		return true, nil
+	}
+	if interaction == noInteraction {
+		return false, fmt.Errorf("%s needs --yes with --no-interaction", strings.TrimSuffix(prompt, "?"))
+	}
+	ok := false
+	err := interact.NewInteraction(prompt).Resolve(&ok)
+	return ok, err
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/NearlyUnique/awsqueue/queue"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+const (
+	metricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+	// metricsStaleAfter is how long past the cache interval the last listing is served while listing fails
+	metricsStaleAfter = 5 * time.Minute
+)
+
+type (
+	metricsOptions struct {
+		list          listQueueOptions
+		region        string
+		listen        string
+		cacheInterval time.Duration
+		ctx           context.Context
+	}
+	// metricsCollector lists queues on each scrape, or at most once per cacheInterval
+	metricsCollector struct {
+		mu            sync.Mutex
+		list          func() (QueueSearchResult, error)
+		region        string
+		cacheInterval time.Duration
+		listed        time.Time
+		// succeeded is when result was listed, up is false when the latest listing failed
+		succeeded time.Time
+		up        bool
+		result    QueueSearchResult
+		duration  time.Duration
+		scrapes   int64
+		errors    int64
+	}
+	queueGauge struct {
+		name string
+		help string
+		attr string
+	}
+)
+
+var queueGauges = []queueGauge{
+	{"awsqueue_messages_visible", "Approximate number of messages available for retrieval.", sqs.QueueAttributeNameApproximateNumberOfMessages},
+	{"awsqueue_messages_in_flight", "Approximate number of messages received but not yet deleted.", sqs.QueueAttributeNameApproximateNumberOfMessagesNotVisible},
+	{"awsqueue_messages_delayed", "Approximate number of messages delayed and not yet available.", sqs.QueueAttributeNameApproximateNumberOfMessagesDelayed},
+}
+
+func serveMetrics(options metricsOptions) error {
+	collector := &metricsCollector{
+		list:          func() (QueueSearchResult, error) { return listQueues(options.list) },
+		region:        options.region,
+		cacheInterval: options.cacheInterval,
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", collector)
+	srv := &http.Server{Addr: options.listen, Handler: mux}
+	go func() {
+		<-options.ctx.Done()
+		_ = srv.Shutdown(context.Background())
+	}()
+	_, _ = fmt.Fprintf(os.Stderr, "serving metrics on %s/metrics\n", options.listen)
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+func (c *metricsCollector) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.listed.IsZero() || time.Since(c.listed) >= c.cacheInterval {
+		c.scrape()
+	}
+	w.Header().Set("Content-Type", metricsContentType)
+	writeMetrics(w, c.region, c.result, c.up, c.duration, c.scrapes, c.errors)
+}
+
+// scrape keeps the previous result when listing fails so a blip does not drop every series,
+// once it is older than metricsStaleAfter the queue gauges are dropped
+func (c *metricsCollector) scrape() {
+	started := time.Now()
+	result, err := c.list()
+	c.duration = time.Since(started)
+	c.listed = time.Now()
+	c.scrapes++
+	c.up = err == nil
+	if err != nil {
+		c.errors++
+		_, _ = fmt.Fprintf(os.Stderr, "Error:%v\n", err)
+		if c.listed.Sub(c.succeeded) > c.cacheInterval+metricsStaleAfter {
+			c.result = QueueSearchResult{}
+		}
+		return
+	}
+	c.result = result
+	c.succeeded = c.listed
+}
+
+func writeMetrics(w io.Writer, region string, result QueueSearchResult, up bool, duration time.Duration, scrapes, errors int64) {
+	queues := make([]map[string]flexiString, len(result.Attrs))
+	copy(queues, result.Attrs)
+	sort.Slice(queues, func(i, j int) bool { return queues[i][queue.AttrKeyQueueName] < queues[j][queue.AttrKeyQueueName] })
+
+	for _, g := range queueGauges {
+		_, _ = fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", g.name, g.help, g.name)
+		for _, attr := range queues {
+			value := attr[g.attr].String()
+			if value == "" {
+				continue
+			}
+			_, _ = fmt.Fprintf(w, "%s{%s} %s\n", g.name, metricLabels(region, attr), value)
+		}
+	}
+	upValue := 0
+	if up {
+		upValue = 1
+	}
+	_, _ = fmt.Fprintf(w, "# HELP awsqueue_up Whether the latest listing of queues succeeded.\n")
+	_, _ = fmt.Fprintf(w, "# TYPE awsqueue_up gauge\n")
+	_, _ = fmt.Fprintf(w, "awsqueue_up{region=%s} %d\n", quoteLabel(region), upValue)
+	_, _ = fmt.Fprintf(w, "# HELP awsqueue_scrape_duration_seconds Time taken to list queues and their attributes.\n")
+	_, _ = fmt.Fprintf(w, "# TYPE awsqueue_scrape_duration_seconds gauge\n")
+	_, _ = fmt.Fprintf(w, "awsqueue_scrape_duration_seconds{region=%s} %g\n", quoteLabel(region), duration.Seconds())
+	_, _ = fmt.Fprintf(w, "# HELP awsqueue_scrapes_total Number of times queues have been listed.\n")
+	_, _ = fmt.Fprintf(w, "# TYPE awsqueue_scrapes_total counter\n")
+	_, _ = fmt.Fprintf(w, "awsqueue_scrapes_total{region=%s} %d\n", quoteLabel(region), scrapes)
+	_, _ = fmt.Fprintf(w, "# HELP awsqueue_scrape_errors_total Number of times listing queues failed.\n")
+	_, _ = fmt.Fprintf(w, "# TYPE awsqueue_scrape_errors_total counter\n")
+	_, _ = fmt.Fprintf(w, "awsqueue_scrape_errors_total{region=%s} %d\n", quoteLabel(region), errors)
+}
+
+// metricLabels are queue, region and one tag_<key> label per queue tag, in a stable order.
+// Tag keys that only differ in characters a label cannot hold, e.g. cost-centre and cost_centre,
+// get _2, _3 and so on in the order of their keys
+func metricLabels(region string, attr map[string]flexiString) string {
+	labels := []string{
+		fmt.Sprintf("queue=%s", quoteLabel(attr[queue.AttrKeyQueueName].String())),
+		fmt.Sprintf("region=%s", quoteLabel(region)),
+	}
+	tags := queue.TagsOf(attr)
+	var keys []string
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	used := make(map[string]bool)
+	var tagLabels []string
+	for _, k := range keys {
+		name := "tag_" + labelName(k)
+		for n := 2; used[name]; n++ {
+			name = fmt.Sprintf("tag_%s_%d", labelName(k), n)
+		}
+		used[name] = true
+		tagLabels = append(tagLabels, fmt.Sprintf("%s=%s", name, quoteLabel(tags[k])))
+	}
+	sort.Strings(tagLabels)
+	return strings.Join(append(labels, tagLabels...), ",")
+}
+
+// labelName replaces anything Prometheus does not allow in a label name
+func labelName(key string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' {
+			return r
+		}
+		return '_'
+	}, key)
+}
+
+func quoteLabel(value string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	return `"` + r.Replace(value) + `"`
+}
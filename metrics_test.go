@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/NearlyUnique/awsqueue/queue"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_queue_metrics_are_written_in_prometheus_format(t *testing.T) {
+	result := QueueSearchResult{
+		Attrs: []map[string]flexiString{
+			{
+				queue.AttrKeyQueueName:                                      "orders",
+				queue.AttrKeyQueueTags:                                      queue.TagsAttr(map[string]*string{"team": aws.String("payments"), "cost-centre": aws.String("a\"b")}),
+				sqs.QueueAttributeNameApproximateNumberOfMessages:           "3",
+				sqs.QueueAttributeNameApproximateNumberOfMessagesNotVisible: "1",
+				sqs.QueueAttributeNameApproximateNumberOfMessagesDelayed:    "0",
+			},
+		},
+	}
+	var buf bytes.Buffer
+
+	writeMetrics(&buf, "eu-west-1", result, true, 1500*time.Millisecond, 4, 1)
+
+	out := buf.String()
+	assert.Contains(t, out, "# TYPE awsqueue_messages_visible gauge\n")
+	assert.Contains(t, out, `awsqueue_messages_visible{queue="orders",region="eu-west-1",tag_cost_centre="a\"b",tag_team="payments"} 3`+"\n")
+	assert.Contains(t, out, `awsqueue_messages_in_flight{queue="orders",region="eu-west-1",tag_cost_centre="a\"b",tag_team="payments"} 1`+"\n")
+	assert.Contains(t, out, `awsqueue_scrape_duration_seconds{region="eu-west-1"} 1.5`+"\n")
+	assert.Contains(t, out, `awsqueue_scrape_errors_total{region="eu-west-1"} 1`+"\n")
+	assert.Contains(t, out, `awsqueue_up{region="eu-west-1"} 1`+"\n")
+}
+
+func Test_tag_labels_that_collide_are_numbered(t *testing.T) {
+	attr := map[string]flexiString{
+		queue.AttrKeyQueueName: "orders",
+		queue.AttrKeyQueueTags: queue.TagsAttr(map[string]*string{"cost-centre": aws.String("a"), "cost_centre": aws.String("b"), "cost.centre": aws.String("c")}),
+	}
+
+	labels := metricLabels("eu-west-1", attr)
+
+	assert.Equal(t, `queue="orders",region="eu-west-1",tag_cost_centre="a",tag_cost_centre_2="c",tag_cost_centre_3="b"`, labels)
+}
+
+func Test_metrics_collector(t *testing.T) {
+	calls := 0
+	var failure error
+	c := &metricsCollector{
+		region:        "eu-west-1",
+		cacheInterval: time.Hour,
+		list: func() (QueueSearchResult, error) {
+			calls++
+			return QueueSearchResult{Attrs: []map[string]flexiString{
+				{queue.AttrKeyQueueName: "orders", sqs.QueueAttributeNameApproximateNumberOfMessages: "3"},
+			}}, failure
+		},
+	}
+	scrape := func() string {
+		rec := httptest.NewRecorder()
+		c.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+		return rec.Body.String()
+	}
+
+	t.Run("results are cached for the interval", func(t *testing.T) {
+		scrape()
+		out := scrape()
+
+		assert.Equal(t, 1, calls)
+		assert.Contains(t, out, `awsqueue_messages_visible{queue="orders",region="eu-west-1"} 3`)
+	})
+	t.Run("errors are counted and the last result kept", func(t *testing.T) {
+		c.cacheInterval = 0
+		failure = errors.New("denied")
+
+		out := scrape()
+
+		assert.Contains(t, out, `awsqueue_scrape_errors_total{region="eu-west-1"} 1`)
+		assert.Contains(t, out, `awsqueue_messages_visible{queue="orders",region="eu-west-1"} 3`)
+		assert.Contains(t, out, `awsqueue_up{region="eu-west-1"} 0`)
+	})
+	t.Run("a result older than the stale limit is dropped", func(t *testing.T) {
+		c.succeeded = time.Now().Add(-metricsStaleAfter - time.Minute)
+
+		out := scrape()
+
+		assert.NotContains(t, out, `awsqueue_messages_visible{queue="orders"`)
+		assert.Contains(t, out, `awsqueue_up{region="eu-west-1"} 0`)
+	})
+}
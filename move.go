@@ -0,0 +1,351 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/NearlyUnique/awsqueue/queue"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+const (
+	JournalSent    = "sent"
+	JournalDeleted = "deleted"
+)
+
+type (
+	// moveOptions has a client per side, source and target may be in different accounts and regions
+	moveOptions struct {
+		source            *sqs.SQS
+		sourceURL         string
+		target            *sqs.SQS
+		targetURL         string
+		deleteSource      bool
+		journal           string
+		visibilityTimeout int64
+		transform         messageTransform
+		dryRun            bool
+		preview           int
+		window            *queue.SentWindow
+		location          *time.Location
+		ctx               context.Context
+	}
+	// journalEntry is a message's state, the first line of a journal is a header with only the source and target
+	journalEntry struct {
+		MessageId string `json:"messageId,omitempty"`
+		State     string `json:"state,omitempty"`
+		Source    string `json:"source,omitempty"`
+		Target    string `json:"target,omitempty"`
+		Time      string `json:"time"`
+	}
+	// moveJournal records each message as it is sent and deleted, so a resumed move skips them
+	moveJournal struct {
+		mu       sync.Mutex
+		file     *os.File
+		state    map[string]string
+		location *time.Location
+	}
+	moveCounts struct {
+		moved   int
+		skipped int
+		deleted int
+		failed  int
+	}
+)
+
+func moveMessages(options moveOptions) error {
+	// with --delete-source the moved messages would be received and moved forever
+	if options.sourceURL == options.targetURL {
+		return fmt.Errorf("--to is the source queue %s", options.sourceURL)
+	}
+	if options.dryRun {
+		return previewMove(options)
+	}
+	journal, err := openJournal(options.journal, options.sourceURL, options.targetURL, options.location)
+	if err != nil {
+		return err
+	}
+	defer journal.close()
+	if n := len(journal.state); n > 0 {
+		_, _ = fmt.Fprintf(os.Stderr, "resuming, %d messages already in %s\n", n, options.journal)
+	}
+
+	held := newVisibilityManager(options.source, options.sourceURL, options.visibilityTimeout)
+	stop := held.start(options.ctx)
+	defer stop()
+	read := readQueueOptions{
+		svc:               options.source,
+		queueURL:          options.sourceURL,
+		visibilityTimeout: options.visibilityTimeout,
+		visibility:        held,
+		window:            options.window,
+		location:          options.location,
+		msg:               make(chan []message),
+		err:               make(chan error),
+		ctx:               options.ctx,
+		wg:                &sync.WaitGroup{},
+	}
+	for i := 0; i < 10; i++ {
+		read.wg.Add(1)
+		go readQueueData(read)
+	}
+	done := signalWaitGroupDone(read.wg)
+
+	var counts moveCounts
+	for {
+		select {
+		case <-done:
+			counts.print(options.deleteSource)
+			if options.ctx.Err() != nil {
+				return fmt.Errorf("stopped, run again with the same --journal to resume")
+			}
+			if counts.failed > 0 {
+				return fmt.Errorf("%d messages failed", counts.failed)
+			}
+			return nil
+		case err := <-read.err:
+			_, _ = fmt.Fprintf(os.Stderr, "Error:%v\n", err)
+		case batch := <-read.msg:
+			for _, m := range batch {
+				// anything not deleted stays hidden until the move ends so it is not received again
+				if moveOne(options, journal, m, &counts) {
+					held.forget(m)
+				}
+			}
+		}
+	}
+}
+
+// moveOne sends unless the journal says it was sent before, then deletes from the source if asked,
+// deleted is true once the message is gone from the source
+func moveOne(options moveOptions, journal *moveJournal, m message, counts *moveCounts) (deleted bool) {
+	state := journal.stateOf(m.MessageId)
+	if state == JournalDeleted {
+		counts.skipped++
+		return false
+	}
+	if state == JournalSent {
+		counts.skipped++
+	} else {
+		input := moveInput(options.targetURL, m)
+		if options.transform != nil {
+			if err := options.transform(options.ctx, input); err != nil {
+				counts.failed++
+				_, _ = fmt.Fprintf(os.Stderr, "Error Transforming %s: %v\n", m.MessageId, err)
+				return false
+			}
+		}
+		if _, err := options.target.SendMessageWithContext(options.ctx, input); err != nil {
+			counts.failed++
+			if options.ctx.Err() == nil {
+				_, _ = fmt.Fprintf(os.Stderr, "Error Sending %s: %v\n", m.MessageId, err)
+			}
+			return false
+		}
+		counts.moved++
+		if err := journal.record(m.MessageId, JournalSent, options.targetURL); err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "Error:%v\n", err)
+		}
+	}
+	if !options.deleteSource {
+		return false
+	}
+	_, err := options.source.DeleteMessageWithContext(options.ctx, &sqs.DeleteMessageInput{
+		QueueUrl:      aws.String(options.sourceURL),
+		ReceiptHandle: m.Raw.ReceiptHandle,
+	})
+	if err != nil {
+		counts.failed++
+		_, _ = fmt.Fprintf(os.Stderr, "Error Deleting %s: %v\n", m.MessageId, err)
+		return false
+	}
+	counts.deleted++
+	if err := journal.record(m.MessageId, JournalDeleted, options.targetURL); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Error:%v\n", err)
+	}
+	return true
+}
+
+// previewMove receives up to preview messages, shows them transformed and then releases them
+func previewMove(options moveOptions) error {
+	var received []message
+	defer func() {
+		for _, m := range received {
+			_, _ = options.source.ChangeMessageVisibilityWithContext(context.Background(), &sqs.ChangeMessageVisibilityInput{
+				QueueUrl:          aws.String(options.sourceURL),
+				ReceiptHandle:     m.Raw.ReceiptHandle,
+				VisibilityTimeout: aws.Int64(0),
+			})
+		}
+	}()
+	for len(received) < options.preview {
+		out, err := options.source.ReceiveMessageWithContext(options.ctx, &sqs.ReceiveMessageInput{
+			AttributeNames: []*string{
+				aws.String(sqs.MessageSystemAttributeNameMessageGroupId),
+				aws.String(sqs.MessageSystemAttributeNameMessageDeduplicationId),
+			},
+			MessageAttributeNames: []*string{aws.String(sqs.QueueAttributeNameAll)},
+			QueueUrl:              aws.String(options.sourceURL),
+			MaxNumberOfMessages:   aws.Int64(int64(minInt(10, options.preview-len(received)))),
+			VisibilityTimeout:     aws.Int64(options.visibilityTimeout),
+		})
+		if err != nil {
+			return err
+		}
+		if len(out.Messages) == 0 {
+			break
+		}
+		received = append(received, queue.SimplifyMessages(out, options.location)...)
+	}
+	var ids []string
+	var inputs []*sqs.SendMessageInput
+	for _, m := range received {
+		ids = append(ids, m.MessageId)
+		inputs = append(inputs, moveInput(options.targetURL, m))
+	}
+	previewTransform(options.ctx, os.Stdout, options.transform, ids, inputs)
+	return nil
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// moveInput keeps the body as received and every custom attribute with its data type
+func moveInput(queueURL string, m message) *sqs.SendMessageInput {
+	input := sqs.SendMessageInput{
+		QueueUrl:          aws.String(queueURL),
+		MessageBody:       m.Raw.Body,
+		MessageAttributes: m.Raw.MessageAttributes,
+	}
+	// this is only valid for FIFO queues
+	if group, ok := m.AwsAttrib[sqs.MessageSystemAttributeNameMessageGroupId]; ok {
+		input.MessageGroupId = aws.String(group)
+		if dedup, ok := m.AwsAttrib[sqs.MessageSystemAttributeNameMessageDeduplicationId]; ok {
+			input.MessageDeduplicationId = aws.String(dedup)
+		}
+	}
+	return &input
+}
+
+// openJournal resumes a journal for the same source and target, one for another move is an error
+// as its messages would be skipped without ever reaching this target
+func openJournal(path, source, target string, loc *time.Location) (*moveJournal, error) {
+	journal := &moveJournal{state: make(map[string]string), location: loc}
+	header := false
+	if f, err := os.Open(path); err == nil {
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			var entry journalEntry
+			if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+				_ = f.Close()
+				return nil, fmt.Errorf("failed reading journal %s: %v", path, err)
+			}
+			if entry.MessageId == "" {
+				header = true
+			}
+			if (entry.Source != "" && entry.Source != source) || (entry.Target != "" && entry.Target != target) {
+				_ = f.Close()
+				return nil, fmt.Errorf("journal %s is for moving %s to %s, use another --journal", path, entry.Source, entry.Target)
+			}
+			if entry.MessageId != "" {
+				journal.state[entry.MessageId] = entry.State
+			}
+		}
+		_ = f.Close()
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
+	if err != nil {
+		return nil, err
+	}
+	journal.file = f
+	if !header && len(journal.state) == 0 {
+		if err := journal.write(journalEntry{Source: source, Target: target}); err != nil {
+			journal.close()
+			return nil, err
+		}
+	}
+	return journal, nil
+}
+
+func (j *moveJournal) stateOf(messageID string) string {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.state[messageID]
+}
+
+// record is synced before returning so an interrupted move never repeats a send it has recorded
+func (j *moveJournal) record(messageID, state, target string) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.state[messageID] = state
+	return j.write(journalEntry{MessageId: messageID, State: state, Target: target})
+}
+
+func (j *moveJournal) write(entry journalEntry) error {
+	entry.Time = queue.FormatTime(time.Now().UTC(), j.location)
+	buf, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if _, err := j.file.Write(append(buf, '\n')); err != nil {
+		return err
+	}
+	return j.file.Sync()
+}
+
+func (j *moveJournal) close() {
+	_ = j.file.Close()
+}
+
+func (c moveCounts) print(deleteSource bool) {
+	_, _ = fmt.Fprintf(os.Stderr, "moved %d, skipped %d already in the journal, failed %d", c.moved, c.skipped, c.failed)
+	if deleteSource {
+		_, _ = fmt.Fprintf(os.Stderr, ", deleted %d from the source", c.deleted)
+	}
+	_, _ = fmt.Fprintln(os.Stderr)
+}
+
+// moveTarget creates the target client, by default in the source region with the source profile and no role
+func moveTarget(ctx context.Context, flags cliFlags) (*sqs.SQS, string, error) {
+	if flags.moveTo == "" {
+		return nil, "", errors.New("move needs --to, a queue url, ARN or name")
+	}
+	ref, err := queueRefOf(flags.moveTo, flags.toAccount)
+	if err != nil {
+		return nil, "", err
+	}
+	targetFlags := flags
+	targetFlags.role = flags.toRole
+	if flags.toProfile != "" {
+		targetFlags.profile = flags.toProfile
+	}
+	region := flags.regionArg
+	if flags.toRegion != "" {
+		region = flags.toRegion
+	} else if ref.region != "" {
+		region = ref.region
+	}
+	sess, err := newSession(region, targetFlags)
+	if err != nil {
+		return nil, "", err
+	}
+	svc := sqs.New(sess)
+	queueURL, err := ref.resolve(ctx, svc)
+	return svc, queueURL, err
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_a_move_journal_resumes_where_it_stopped(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journal")
+	require.NoError(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+	path := filepath.Join(dir, "move-journal.jsonl")
+
+	journal, err := openJournal(path, "source", "target", nil)
+	require.NoError(t, err)
+	require.NoError(t, journal.record("m1", JournalSent, "target"))
+	require.NoError(t, journal.record("m2", JournalSent, "target"))
+	require.NoError(t, journal.record("m2", JournalDeleted, "target"))
+	journal.close()
+
+	resumed, err := openJournal(path, "source", "target", nil)
+	require.NoError(t, err)
+	defer resumed.close()
+	assert.Equal(t, JournalSent, resumed.stateOf("m1"))
+	assert.Equal(t, JournalDeleted, resumed.stateOf("m2"))
+	assert.Equal(t, "", resumed.stateOf("m3"))
+
+	t.Run("a corrupt journal is not silently ignored", func(t *testing.T) {
+		bad := filepath.Join(dir, "bad.jsonl")
+		require.NoError(t, ioutil.WriteFile(bad, []byte("sent m1\n"), 0666))
+		_, err := openJournal(bad, "source", "target", nil)
+		assert.Error(t, err)
+	})
+	t.Run("a journal for another move is refused", func(t *testing.T) {
+		_, err := openJournal(path, "source", "elsewhere", nil)
+		assert.Error(t, err)
+
+		_, err = openJournal(path, "other", "target", nil)
+		assert.Error(t, err)
+	})
+	t.Run("an older journal without a header is checked by its targets", func(t *testing.T) {
+		older := filepath.Join(dir, "older.jsonl")
+		require.NoError(t, ioutil.WriteFile(older, []byte(`{"messageId":"m1","state":"sent","target":"target"}`+"\n"), 0666))
+
+		_, err := openJournal(older, "source", "elsewhere", nil)
+		assert.Error(t, err)
+	})
+}
+
+func Test_a_move_to_the_source_queue_is_refused(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journal")
+	require.NoError(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+	path := filepath.Join(dir, "move-journal.jsonl")
+
+	err = moveMessages(moveOptions{sourceURL: "orders-url", targetURL: "orders-url", deleteSource: true, journal: path, ctx: context.Background()})
+
+	assert.Error(t, err)
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err), "no journal is started")
+}
+
+func Test_moving_keeps_attributes_as_received(t *testing.T) {
+	attrs := map[string]*sqs.MessageAttributeValue{
+		"retries": {DataType: aws.String("Number"), StringValue: aws.String("3")},
+	}
+	m := message{
+		AwsAttrib: map[string]string{
+			sqs.MessageSystemAttributeNameMessageGroupId:         "g1",
+			sqs.MessageSystemAttributeNameMessageDeduplicationId: "d1",
+		},
+		// the decoded body must not be sent, only what was received
+		Message: `{"id":1}`,
+		Raw:     &sqs.Message{Body: aws.String(`eyJpZCI6MX0=`), MessageAttributes: attrs},
+	}
+	input := moveInput("https://sqs.us-east-1.amazonaws.com/123456789012/staging", m)
+	assert.Equal(t, "eyJpZCI6MX0=", aws.StringValue(input.MessageBody))
+	assert.Equal(t, "Number", aws.StringValue(input.MessageAttributes["retries"].DataType))
+	assert.Equal(t, "g1", aws.StringValue(input.MessageGroupId))
+	assert.Equal(t, "d1", aws.StringValue(input.MessageDeduplicationId))
+}
+
+func Test_a_move_needs_a_target(t *testing.T) {
+	_, _, err := moveTarget(context.Background(), cliFlags{regionArg: "eu-west-1"})
+	assert.Error(t, err)
+}
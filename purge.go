@@ -0,0 +1,31 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+)
+
+type purgeOptions struct {
+	svc         sqsiface.SQSAPI
+	queueURL    string
+	dryRun      bool
+	interaction interactionType
+	yes         bool
+	ctx         context.Context
+}
+
+func purgeQueue(options purgeOptions) error {
+	fmt.Printf("purge %s\n", options.queueURL)
+	if options.dryRun {
+		return nil
+	}
+	ok, err := confirm("Delete every message in the queue?", options.interaction, options.yes)
+	if err != nil || !ok {
+		return err
+	}
+	_, err = options.svc.PurgeQueueWithContext(options.ctx, &sqs.PurgeQueueInput{QueueUrl: &options.queueURL})
+	return err
+}
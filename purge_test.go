@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeQueueAdmin records purge and tag calls, any other call panics on the nil SQSAPI
+type fakeQueueAdmin struct {
+	sqsiface.SQSAPI
+	purged   []string
+	tagged   map[string]map[string]string
+	untagged map[string][]string
+}
+
+func (f *fakeQueueAdmin) PurgeQueueWithContext(_ aws.Context, input *sqs.PurgeQueueInput, _ ...request.Option) (*sqs.PurgeQueueOutput, error) {
+	f.purged = append(f.purged, aws.StringValue(input.QueueUrl))
+	return &sqs.PurgeQueueOutput{}, nil
+}
+
+func (f *fakeQueueAdmin) TagQueueWithContext(_ aws.Context, input *sqs.TagQueueInput, _ ...request.Option) (*sqs.TagQueueOutput, error) {
+	if f.tagged == nil {
+		f.tagged = make(map[string]map[string]string)
+	}
+	f.tagged[aws.StringValue(input.QueueUrl)] = aws.StringValueMap(input.Tags)
+	return &sqs.TagQueueOutput{}, nil
+}
+
+func (f *fakeQueueAdmin) UntagQueueWithContext(_ aws.Context, input *sqs.UntagQueueInput, _ ...request.Option) (*sqs.UntagQueueOutput, error) {
+	if f.untagged == nil {
+		f.untagged = make(map[string][]string)
+	}
+	f.untagged[aws.StringValue(input.QueueUrl)] = aws.StringValueSlice(input.TagKeys)
+	return &sqs.UntagQueueOutput{}, nil
+}
+
+func Test_purging_a_queue(t *testing.T) {
+	purge := func(fake *fakeQueueAdmin, dryRun, yes bool) error {
+		return purgeQueue(purgeOptions{
+			svc:         fake,
+			queueURL:    "http://any.com/1/orders",
+			dryRun:      dryRun,
+			interaction: noInteraction,
+			yes:         yes,
+			ctx:         context.Background(),
+		})
+	}
+	t.Run("a dry run makes no calls", func(t *testing.T) {
+		fake := &fakeQueueAdmin{}
+
+		require.NoError(t, purge(fake, true, false))
+		assert.Empty(t, fake.purged)
+	})
+	t.Run("without --yes it is refused", func(t *testing.T) {
+		fake := &fakeQueueAdmin{}
+
+		err := purge(fake, false, false)
+
+		assert.EqualError(t, err, "Delete every message in the queue needs --yes with --no-interaction")
+		assert.Empty(t, fake.purged)
+	})
+	t.Run("with --yes the queue is purged", func(t *testing.T) {
+		fake := &fakeQueueAdmin{}
+
+		require.NoError(t, purge(fake, false, true))
+		assert.Equal(t, []string{"http://any.com/1/orders"}, fake.purged)
+	})
+}
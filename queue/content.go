@@ -0,0 +1,88 @@
+package queue
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"strings"
+)
+
+const (
+	ContentTypeJSON = "json"
+	ContentTypeXML  = "xml"
+	ContentTypeText = "text"
+)
+
+// DetectContentType is one of ContentTypeJSON, ContentTypeXML or ContentTypeText
+func DetectContentType(body string) string {
+	trimmed := strings.TrimSpace(body)
+	if trimmed == "" {
+		return ContentTypeText
+	}
+	if json.Valid([]byte(trimmed)) {
+		return ContentTypeJSON
+	}
+	if strings.HasPrefix(trimmed, "<") && isXML(trimmed) {
+		return ContentTypeXML
+	}
+	return ContentTypeText
+}
+
+func isXML(s string) bool {
+	d := xml.NewDecoder(strings.NewReader(s))
+	elements := 0
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			return elements > 0
+		}
+		if err != nil {
+			return false
+		}
+		if _, ok := tok.(xml.StartElement); ok {
+			elements++
+		}
+	}
+}
+
+// MarshalJSON embeds json bodies as structured json, anything else is written as a string
+func (m Message) MarshalJSON() ([]byte, error) {
+	type plain Message
+	if m.ContentType != ContentTypeJSON {
+		return json.Marshal(plain(m))
+	}
+	return json.Marshal(struct {
+		plain
+		Message json.RawMessage `json:"message"`
+	}{
+		plain:   plain(m),
+		Message: json.RawMessage(strings.TrimSpace(m.Message.String())),
+	})
+}
+
+// UnmarshalJSON reads messages written by MarshalJSON, so result files can be sent again
+func (m *Message) UnmarshalJSON(buf []byte) error {
+	type plain Message
+	aux := struct {
+		*plain
+		Message json.RawMessage `json:"message"`
+	}{plain: (*plain)(m)}
+	if err := json.Unmarshal(buf, &aux); err != nil {
+		return err
+	}
+	if len(aux.Message) == 0 {
+		return nil
+	}
+	var s string
+	if m.ContentType != ContentTypeJSON && json.Unmarshal(aux.Message, &s) == nil {
+		m.Message = FlexiString(s)
+		return nil
+	}
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, aux.Message); err != nil {
+		return err
+	}
+	m.Message = FlexiString(compact.String())
+	return nil
+}
@@ -0,0 +1,48 @@
+package queue
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_content_type_is_detected(t *testing.T) {
+	tests := map[string]string{
+		`{"some":true}`:             ContentTypeJSON,
+		`[1,2,3]`:                   ContentTypeJSON,
+		`42`:                        ContentTypeJSON,
+		`<a><b>text</b></a>`:        ContentTypeXML,
+		`<?xml version="1.0"?><a/>`: ContentTypeXML,
+		`{"some":}`:                 ContentTypeText,
+		`<a><b></a>`:                ContentTypeText,
+		`some text`:                 ContentTypeText,
+		``:                          ContentTypeText,
+	}
+	for body, expected := range tests {
+		assert.Equal(t, expected, DetectContentType(body), body)
+	}
+}
+
+func Test_message_bodies_are_always_written_as_valid_json(t *testing.T) {
+	t.Run("a json array is embedded", func(t *testing.T) {
+		buf, err := json.Marshal(Message{Message: `[1,2]`, ContentType: ContentTypeJSON})
+
+		require.NoError(t, err)
+		assert.Contains(t, string(buf), `"message":[1,2]`)
+	})
+	t.Run("a json number is embedded", func(t *testing.T) {
+		buf, err := json.Marshal(Message{Message: `42`, ContentType: ContentTypeJSON})
+
+		require.NoError(t, err)
+		assert.Contains(t, string(buf), `"message":42`)
+	})
+	t.Run("broken json is written as a string", func(t *testing.T) {
+		buf, err := json.Marshal(Message{Message: `{"some":}`, ContentType: ContentTypeText})
+
+		require.NoError(t, err)
+		assert.True(t, json.Valid(buf))
+		assert.Contains(t, string(buf), `"contentType":"text"`)
+	})
+}
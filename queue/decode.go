@@ -0,0 +1,130 @@
+package queue
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	DecodedSns    = "sns"
+	DecodedBase64 = "base64"
+	DecodedGzip   = "gzip"
+)
+
+// limit the number of unwrapping passes, a body could be sns(base64(gzip(...)))
+const maxDecodePasses = 5
+
+type (
+	snsEnvelope struct {
+		Type              string                  `json:"Type"`
+		TopicArn          string                  `json:"TopicArn"`
+		Message           *string                 `json:"Message"`
+		MessageAttributes map[string]snsAttribute `json:"MessageAttributes"`
+	}
+	snsAttribute struct {
+		Type  string `json:"Type"`
+		Value string `json:"Value"`
+	}
+	// DecodedBody is the unwrapped body, Steps lists each decoding applied in order
+	DecodedBody struct {
+		Body       string
+		Steps      []string
+		CustAttrib map[string]string
+	}
+)
+
+// DecodeBody repeatedly unwraps SNS envelopes, base64 and gzip until the body no longer changes
+func DecodeBody(body string) DecodedBody {
+	result := DecodedBody{Body: body}
+	for i := 0; i < maxDecodePasses; i++ {
+		if env, ok := snsNotification(result.Body); ok {
+			result.Body = *env.Message
+			result.Steps = append(result.Steps, DecodedSns)
+			for k, v := range env.MessageAttributes {
+				if result.CustAttrib == nil {
+					result.CustAttrib = make(map[string]string)
+				}
+				result.CustAttrib[k] = v.Value
+			}
+			continue
+		}
+		if buf, ok := decodeBase64(result.Body); ok {
+			steps := []string{DecodedBase64}
+			if unzipped, ok := gunzip(buf); ok {
+				buf = unzipped
+				steps = append(steps, DecodedGzip)
+			}
+			if !isText(buf) {
+				break
+			}
+			result.Body = string(buf)
+			result.Steps = append(result.Steps, steps...)
+			continue
+		}
+		break
+	}
+	return result
+}
+
+func snsNotification(body string) (snsEnvelope, bool) {
+	var env snsEnvelope
+	trimmed := strings.TrimSpace(body)
+	if !strings.HasPrefix(trimmed, "{") {
+		return env, false
+	}
+	if err := json.Unmarshal([]byte(trimmed), &env); err != nil {
+		return env, false
+	}
+	if env.Type != "Notification" || env.TopicArn == "" || env.Message == nil {
+		return env, false
+	}
+	return env, true
+}
+
+func decodeBase64(body string) ([]byte, bool) {
+	s := strings.TrimSpace(body)
+	// too short or not a multiple of 4 is almost certainly plain text
+	if len(s) < 8 || len(s)%4 != 0 {
+		return nil, false
+	}
+	buf, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, false
+	}
+	return buf, true
+}
+
+func gunzip(buf []byte) ([]byte, bool) {
+	if len(buf) < 2 || buf[0] != 0x1f || buf[1] != 0x8b {
+		return nil, false
+	}
+	r, err := gzip.NewReader(bytes.NewReader(buf))
+	if err != nil {
+		return nil, false
+	}
+	defer func() { _ = r.Close() }()
+	out, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, false
+	}
+	return out, true
+}
+
+// isText rejects binary payloads so we do not replace a body with garbage
+func isText(buf []byte) bool {
+	if !utf8.Valid(buf) {
+		return false
+	}
+	for _, r := range string(buf) {
+		if !unicode.IsPrint(r) && !unicode.IsSpace(r) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,91 @@
+package queue
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_message_bodies_are_decoded(t *testing.T) {
+	t.Run("plain text is left alone", func(t *testing.T) {
+		actual := DecodeBody("some text")
+
+		assert.Equal(t, "some text", actual.Body)
+		assert.Empty(t, actual.Steps)
+	})
+	t.Run("an sns envelope is unwrapped and its attributes returned", func(t *testing.T) {
+		body := `{"Type":"Notification","TopicArn":"arn:aws:sns:eu-west-1:1:topic","Message":"{\"some\":true}",` +
+			`"MessageAttributes":{"event":{"Type":"String","Value":"created"}}}`
+
+		actual := DecodeBody(body)
+
+		assert.Equal(t, `{"some":true}`, actual.Body)
+		assert.Equal(t, []string{DecodedSns}, actual.Steps)
+		assert.Equal(t, "created", actual.CustAttrib["event"])
+	})
+	t.Run("json that is not an sns notification is left alone", func(t *testing.T) {
+		actual := DecodeBody(`{"Type":"Other","Message":"x"}`)
+
+		assert.Equal(t, `{"Type":"Other","Message":"x"}`, actual.Body)
+		assert.Empty(t, actual.Steps)
+	})
+	t.Run("base64 text is decoded", func(t *testing.T) {
+		body := base64.StdEncoding.EncodeToString([]byte(`{"some":true}`))
+
+		actual := DecodeBody(body)
+
+		assert.Equal(t, `{"some":true}`, actual.Body)
+		assert.Equal(t, []string{DecodedBase64}, actual.Steps)
+	})
+	t.Run("gzip and base64 is decoded", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		_, _ = w.Write([]byte(`{"some":true}`))
+		require.NoError(t, w.Close())
+		body := base64.StdEncoding.EncodeToString(buf.Bytes())
+
+		actual := DecodeBody(body)
+
+		assert.Equal(t, `{"some":true}`, actual.Body)
+		assert.Equal(t, []string{DecodedBase64, DecodedGzip}, actual.Steps)
+	})
+	t.Run("base64 of binary data is left encoded", func(t *testing.T) {
+		body := base64.StdEncoding.EncodeToString([]byte{0, 1, 2, 3, 4, 5, 6, 7, 8})
+
+		actual := DecodeBody(body)
+
+		assert.Equal(t, body, actual.Body)
+		assert.Empty(t, actual.Steps)
+	})
+	t.Run("a base64 payload inside an sns envelope is fully decoded", func(t *testing.T) {
+		inner := base64.StdEncoding.EncodeToString([]byte(`{"some":true}`))
+		body := `{"Type":"Notification","TopicArn":"arn:aws:sns:eu-west-1:1:topic","Message":"` + inner + `"}`
+
+		actual := DecodeBody(body)
+
+		assert.Equal(t, `{"some":true}`, actual.Body)
+		assert.Equal(t, []string{DecodedSns, DecodedBase64}, actual.Steps)
+	})
+}
+
+func Test_a_decoded_sns_message_is_embedded_as_json(t *testing.T) {
+	awsMsg := sqs.ReceiveMessageOutput{
+		Messages: builder().
+			addMsg(`{"Type":"Notification","TopicArn":"arn:aws:sns:eu-west-1:1:topic","Message":"{\"some\":true}",` +
+				`"MessageAttributes":{"event":{"Type":"String","Value":"created"}}}`).
+			build(),
+	}
+	actual := SimplifyMessages(&awsMsg, nil)
+
+	require.NotEmpty(t, actual)
+	assert.Equal(t, "created", actual[0].CustAttrib["event"])
+	buf, err := json.Marshal(actual[0])
+	require.NoError(t, err)
+	assert.Contains(t, string(buf), `"message":{"some":true}`)
+}
@@ -0,0 +1,32 @@
+// Package queue lists, reads, sends and summarises Amazon SQS messages, it is the core of the awsqueue command.
+//
+// Queues are found with List, which reads their attributes and tags:
+//
+//	svc := sqs.New(session.Must(session.NewSession()))
+//	result, err := queue.List(ctx, svc, queue.ListOptions{Filter: "orders"})
+//
+// Read receives until the queue is empty, decoding SNS envelopes, base64 and gzip bodies on the way.
+// The messages stay hidden for the visibility timeout, delete them with their Raw receipt handle:
+//
+//	messages, errs := queue.Read(ctx, svc, queueURL, queue.ReceiveOptions{VisibilityTimeout: 60})
+//	var sum queue.Summary
+//	for messages != nil || errs != nil {
+//		select {
+//		case batch, ok := <-messages:
+//			if !ok {
+//				messages = nil
+//				continue
+//			}
+//			sum.Add(batch)
+//		case err, ok := <-errs:
+//			if !ok {
+//				errs = nil
+//				continue
+//			}
+//			log.Println(err)
+//		}
+//	}
+//	sum.Analyse(10, nil)
+//
+// SendBatch sends messages with the body and attributes they were received with, so they can be copied to another queue.
+package queue
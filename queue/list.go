@@ -0,0 +1,194 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+)
+
+// keys added to the queue attributes alongside those returned by SQS
+const (
+	AttrKeyQueueUrl  = "_Url"
+	AttrKeyQueueName = "_Name"
+	AttrKeyQueueTags = "_Tags"
+)
+
+type (
+	// SearchResult is the attributes of every queue matching the filter and tags
+	SearchResult struct {
+		Filter      string                   `json:"filter"`
+		AllMessages bool                     `json:"allMessages"`
+		Tags        map[string]string        `json:"tags,omitempty"`
+		Attrs       []map[string]FlexiString `json:"awsAttributes"`
+	}
+	// ListOptions selects queues, the zero value lists every queue
+	ListOptions struct {
+		// Filter matches any part of the queue url, case insensitively
+		Filter string
+		// Tags must all be on a queue, values are compared case insensitively
+		Tags map[string]string
+		// AllMessages keeps queues without visible messages in FilteredQueues
+		AllMessages bool
+		// Warn, when set, is told about tags that could not be listed, the queue is still included
+		Warn func(err error)
+		// Location shows the formatted timestamps in that zone, see FormatTime
+		Location *time.Location
+	}
+)
+
+// List reads the attributes and tags of every queue matching the options
+func List(ctx context.Context, svc sqsiface.SQSAPI, options ListOptions) (SearchResult, error) {
+	list, err := svc.ListQueuesWithContext(ctx, &sqs.ListQueuesInput{})
+	if err != nil {
+		return SearchResult{}, err
+	}
+	return Describe(ctx, svc, options, aws.StringValueSlice(list.QueueUrls)...)
+}
+
+// Describe reads the attributes and tags of the given queues, skipping any not matching the options
+func Describe(ctx context.Context, svc sqsiface.SQSAPI, options ListOptions, queueURLs ...string) (SearchResult, error) {
+	var wg sync.WaitGroup
+	ch := make(chan map[string]FlexiString)
+	errs := make(chan error, len(queueURLs))
+
+	results := SearchResult{
+		Filter:      options.Filter,
+		AllMessages: options.AllMessages,
+		Tags:        options.Tags,
+	}
+
+	for _, q := range queueURLs {
+		if results.MatchesFilter(q) {
+			wg.Add(1)
+			go func(q string) {
+				defer wg.Done()
+				attrQuery := sqs.GetQueueAttributesInput{
+					QueueUrl:       &q,
+					AttributeNames: []*string{aws.String(sqs.QueueAttributeNameAll)},
+				}
+
+				attr, err := svc.GetQueueAttributesWithContext(ctx, &attrQuery)
+				if err != nil {
+					errs <- fmt.Errorf("failed at: %v %v", q, err)
+					return
+				}
+				parts := strings.Split(q, "/")
+				attrs := map[string]FlexiString{
+					AttrKeyQueueUrl:  FlexiString(q),
+					AttrKeyQueueName: FlexiString(parts[len(parts)-1]),
+				}
+				for key, value := range attr.Attributes {
+					if ok, ts := IsTimestamp(key, *value); ok {
+						attrs["_"+key] = FlexiString(FormatTimestamp(ts, options.Location))
+						attrs["_"+key+AgeSuffix] = FlexiString(TimestampAge(ts))
+					}
+					attrs[key] = FlexiString(*value)
+				}
+				tags, err := svc.ListQueueTagsWithContext(ctx, &sqs.ListQueueTagsInput{QueueUrl: &q})
+				if err != nil {
+					if options.Warn != nil {
+						options.Warn(fmt.Errorf("failed listing tags: %v %v", q, err))
+					}
+				} else {
+					attrs[AttrKeyQueueTags] = TagsAttr(tags.Tags)
+				}
+				if !results.MatchesTags(attrs) {
+					return
+				}
+				ch <- attrs
+			}(q)
+		}
+	}
+	go func() {
+		wg.Wait()
+		close(ch)
+	}()
+
+	for a := range ch {
+		results.Attrs = append(results.Attrs, a)
+	}
+	close(errs)
+	if err := <-errs; err != nil {
+		return results, err
+	}
+
+	return results, nil
+}
+
+// MatchesFilter is true when the filter is empty or part of the queue url or name
+func (result SearchResult) MatchesFilter(queue string) bool {
+	return result.Filter == "" || strings.Contains(strings.ToLower(queue), strings.ToLower(result.Filter))
+}
+
+// MatchesTags is true when the queue has every tag, values are compared case insensitively
+func (result SearchResult) MatchesTags(attr map[string]FlexiString) bool {
+	if len(result.Tags) == 0 {
+		return true
+	}
+	tags := TagsOf(attr)
+	for k, v := range result.Tags {
+		if actual, ok := tags[k]; !ok || !strings.EqualFold(actual, v) {
+			return false
+		}
+	}
+	return true
+}
+
+// FilteredQueues are the queues matching the filter and tags, only those with messages unless AllMessages is set
+func (result SearchResult) FilteredQueues() []map[string]FlexiString {
+	var filtered []map[string]FlexiString
+	for _, attr := range result.Attrs {
+		hasMessages := attr[sqs.QueueAttributeNameApproximateNumberOfMessages] != "0" && attr[sqs.QueueAttributeNameApproximateNumberOfMessages] != ""
+		if (result.AllMessages || (!result.AllMessages && hasMessages)) &&
+			result.MatchesFilter(attr[AttrKeyQueueName].String()) && result.MatchesTags(attr) {
+			filtered = append(filtered, attr)
+		}
+	}
+	return filtered
+}
+
+// ExactMatch is the queue named exactly as the filter, ignoring case, or nil
+func (result SearchResult) ExactMatch() map[string]FlexiString {
+	for _, attr := range result.Attrs {
+		if strings.EqualFold(result.Filter, attr[AttrKeyQueueName].String()) {
+			return attr
+		}
+	}
+	return nil
+}
+
+// AttrsFor is the attributes of the queue with the url, or nil
+func (result SearchResult) AttrsFor(queueURL string) map[string]FlexiString {
+	for _, attr := range result.Attrs {
+		if attr[AttrKeyQueueUrl].String() == queueURL {
+			return attr
+		}
+	}
+	return nil
+}
+
+// TagsAttr stores tags as a json object so they are embedded in json output
+func TagsAttr(tags map[string]*string) FlexiString {
+	plain := make(map[string]string)
+	for k, v := range tags {
+		plain[k] = aws.StringValue(v)
+	}
+	buf, _ := json.Marshal(plain)
+	return FlexiString(buf)
+}
+
+// TagsOf reads the tags stored by TagsAttr
+func TagsOf(attr map[string]FlexiString) map[string]string {
+	tags := make(map[string]string)
+	if raw := attr[AttrKeyQueueTags]; raw != "" {
+		_ = json.Unmarshal([]byte(raw), &tags)
+	}
+	return tags
+}
@@ -0,0 +1,112 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeList struct {
+	sqsiface.SQSAPI
+	queues map[string]map[string]string
+	tags   map[string]map[string]string
+}
+
+func (f fakeList) ListQueuesWithContext(aws.Context, *sqs.ListQueuesInput, ...request.Option) (*sqs.ListQueuesOutput, error) {
+	var out sqs.ListQueuesOutput
+	for url := range f.queues {
+		out.QueueUrls = append(out.QueueUrls, aws.String(url))
+	}
+	return &out, nil
+}
+
+func (f fakeList) GetQueueAttributesWithContext(_ aws.Context, input *sqs.GetQueueAttributesInput, _ ...request.Option) (*sqs.GetQueueAttributesOutput, error) {
+	return &sqs.GetQueueAttributesOutput{Attributes: aws.StringMap(f.queues[*input.QueueUrl])}, nil
+}
+
+func (f fakeList) ListQueueTagsWithContext(_ aws.Context, input *sqs.ListQueueTagsInput, _ ...request.Option) (*sqs.ListQueueTagsOutput, error) {
+	tags, ok := f.tags[*input.QueueUrl]
+	if !ok {
+		return nil, errors.New("access denied")
+	}
+	return &sqs.ListQueueTagsOutput{Tags: aws.StringMap(tags)}, nil
+}
+
+func Test_queues_are_listed_with_their_attributes(t *testing.T) {
+	svc := fakeList{
+		queues: map[string]map[string]string{
+			"http://any.com/1/orders":   {sqs.QueueAttributeNameApproximateNumberOfMessages: "3", sqs.QueueAttributeNameCreatedTimestamp: "1574340442"},
+			"http://any.com/1/payments": {sqs.QueueAttributeNameApproximateNumberOfMessages: "0"},
+		},
+		tags: map[string]map[string]string{"http://any.com/1/orders": {"team": "orders"}},
+	}
+	t.Run("the filter selects queues by url", func(t *testing.T) {
+		result, err := List(context.Background(), svc, ListOptions{Filter: "ORDERS", Location: time.UTC})
+
+		require.NoError(t, err)
+		require.Len(t, result.Attrs, 1)
+		attrs := result.Attrs[0]
+		assert.Equal(t, FlexiString("orders"), attrs[AttrKeyQueueName])
+		assert.Equal(t, FlexiString("3"), attrs[sqs.QueueAttributeNameApproximateNumberOfMessages])
+		assert.Equal(t, FlexiString("2019-11-21T12:47:22Z"), attrs["_"+sqs.QueueAttributeNameCreatedTimestamp])
+		assert.Contains(t, attrs["_"+sqs.QueueAttributeNameCreatedTimestamp+AgeSuffix], " ago")
+		assert.Equal(t, map[string]string{"team": "orders"}, TagsOf(attrs))
+	})
+	t.Run("tags that cannot be listed are a warning", func(t *testing.T) {
+		var warnings []error
+
+		result, err := Describe(context.Background(), svc, ListOptions{Warn: func(err error) { warnings = append(warnings, err) }}, "http://any.com/1/payments")
+
+		require.NoError(t, err)
+		assert.Len(t, result.Attrs, 1)
+		assert.Len(t, warnings, 1)
+	})
+}
+
+func Test_queues_can_be_filtered_by_tag(t *testing.T) {
+	payments := map[string]FlexiString{
+		AttrKeyQueueName: "payments",
+		AttrKeyQueueTags: TagsAttr(map[string]*string{"team": aws.String("payments"), "service": aws.String("api")}),
+	}
+	untagged := map[string]FlexiString{AttrKeyQueueName: "untagged"}
+
+	t.Run("no tag filter matches everything", func(t *testing.T) {
+		result := SearchResult{}
+
+		assert.True(t, result.MatchesTags(payments))
+		assert.True(t, result.MatchesTags(untagged))
+	})
+	t.Run("every tag must match", func(t *testing.T) {
+		assert.True(t, SearchResult{Tags: map[string]string{"team": "Payments"}}.MatchesTags(payments))
+		assert.False(t, SearchResult{Tags: map[string]string{"team": "payments", "service": "web"}}.MatchesTags(payments))
+		assert.False(t, SearchResult{Tags: map[string]string{"team": "payments"}}.MatchesTags(untagged))
+	})
+	t.Run("filtered queues respect tags", func(t *testing.T) {
+		result := SearchResult{
+			AllMessages: true,
+			Tags:        map[string]string{"team": "payments"},
+			Attrs:       []map[string]FlexiString{payments, untagged},
+		}
+
+		assert.Equal(t, []map[string]FlexiString{payments}, result.FilteredQueues())
+	})
+}
+
+func Test_tags_are_written_as_a_json_object(t *testing.T) {
+	attrs := map[string]FlexiString{AttrKeyQueueTags: TagsAttr(map[string]*string{"team": aws.String("payments")})}
+
+	buf, err := json.Marshal(attrs)
+
+	require.NoError(t, err)
+	assert.Equal(t, `{"_Tags":{"team":"payments"}}`, string(buf))
+	assert.Equal(t, map[string]string{"team": "payments"}, TagsOf(attrs))
+}
@@ -0,0 +1,131 @@
+package queue
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+type (
+	// Message is a received message with its attributes as strings and its body decoded
+	Message struct {
+		MessageId  string            `json:"messageId"`
+		MD5OfBody  string            `json:"md5OfBody"`
+		CustAttrib map[string]string `json:"customAttributes"`
+		AwsAttrib  map[string]string `json:"awsAttributes"`
+		Message    FlexiString       `json:"message"`
+		Decoded    []string          `json:"decoded,omitempty"`
+		// Body is the body as received when Message is not, e.g. decoded or compacted json
+		Body string `json:"body,omitempty"`
+		// TypedAttrib is the custom attributes as received with their data types, without any from an SNS envelope
+		TypedAttrib map[string]*sqs.MessageAttributeValue `json:"typedAttributes,omitempty"`
+		// ContentType is one of json, xml or text
+		ContentType string `json:"contentType"`
+		// Raw is the message as received, before any decoding, it is nil for messages read from a file
+		Raw *sqs.Message `json:"-"`
+	}
+	// FlexiString is written as json when it holds valid json, such as an object, array or number, otherwise as a string
+	FlexiString string
+)
+
+func (fs FlexiString) String() string {
+	return string(fs)
+}
+
+// MarshalJSON custom
+func (fs FlexiString) MarshalJSON() ([]byte, error) {
+	if len(fs) > 0 && json.Valid([]byte(fs)) {
+		return []byte(fs), nil
+	}
+	var buffer bytes.Buffer
+	buf, err := json.Marshal(string(fs))
+	if err != nil {
+		return nil, err
+	}
+	_, err = buffer.Write(buf)
+	return buffer.Bytes(), err
+}
+
+// UnmarshalJSON reads what MarshalJSON wrote, a json string is its text and anything else is kept as json
+func (fs *FlexiString) UnmarshalJSON(buf []byte) error {
+	var s string
+	if err := json.Unmarshal(buf, &s); err == nil {
+		*fs = FlexiString(s)
+		return nil
+	}
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, buf); err != nil {
+		return err
+	}
+	*fs = FlexiString(compact.String())
+	return nil
+}
+
+// SimplifyMessages converts received messages, timestamps also get _<name> and _<name>Age attributes formatted in loc
+func SimplifyMessages(input *sqs.ReceiveMessageOutput, loc *time.Location) []Message {
+	var result []Message
+	for _, m := range input.Messages {
+		msg := Message{
+			AwsAttrib:   make(map[string]string),
+			CustAttrib:  make(map[string]string),
+			ContentType: ContentTypeText,
+			MessageId:   aws.StringValue(m.MessageId),
+			MD5OfBody:   aws.StringValue(m.MD5OfBody),
+			Raw:         m,
+		}
+		for k, v := range m.Attributes {
+			val := "<nil>"
+			if v != nil {
+				if ok, ts := IsTimestamp(k, *v); ok {
+					msg.AwsAttrib["_"+k] = FormatTimestamp(ts, loc)
+					msg.AwsAttrib["_"+k+AgeSuffix] = TimestampAge(ts)
+				}
+				val = *v
+
+			}
+			msg.AwsAttrib[k] = val
+		}
+		for k, v := range m.MessageAttributes {
+			val := "<nil>"
+			if v != nil {
+				val = *v.StringValue
+			}
+			msg.CustAttrib[k] = val
+		}
+		if len(m.MessageAttributes) > 0 {
+			msg.TypedAttrib = m.MessageAttributes
+		}
+		if m.Body != nil {
+			decoded := DecodeBody(*m.Body)
+			msg.Message = FlexiString(decoded.Body)
+			msg.Decoded = decoded.Steps
+			msg.ContentType = DetectContentType(decoded.Body)
+			if written(msg) != *m.Body {
+				msg.Body = *m.Body
+			}
+			for k, v := range decoded.CustAttrib {
+				if _, ok := msg.CustAttrib[k]; !ok {
+					msg.CustAttrib[k] = v
+				}
+			}
+		}
+		result = append(result, msg)
+	}
+	return result
+}
+
+// written is the body as it reads back from json, json bodies are compacted
+func written(m Message) string {
+	if m.ContentType != ContentTypeJSON {
+		return m.Message.String()
+	}
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, []byte(strings.TrimSpace(m.Message.String()))); err != nil {
+		return m.Message.String()
+	}
+	return compact.String()
+}
@@ -0,0 +1,80 @@
+package queue
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_flexistring_json_marshalling(t *testing.T) {
+	type testType struct {
+		Value FlexiString
+	}
+	t.Run("a basic string comes out as text", func(t *testing.T) {
+		fs := testType{`some text`}
+
+		buf, err := json.Marshal(fs)
+
+		require.NoError(t, err)
+		assert.Equal(t, string(buf), `{"Value":"some text"}`)
+	})
+	t.Run("when the string looks like a json object it is treated as such", func(t *testing.T) {
+		fs := testType{`{"some":true}`}
+
+		buf, err := json.Marshal(fs)
+
+		require.NoError(t, err)
+		assert.Equal(t, string(buf), `{"Value":{"some":true}}`)
+	})
+	t.Run("when the string looks like a json object but is invalid it is treated as text", func(t *testing.T) {
+		fs := testType{`{"some":}`}
+
+		buf, err := json.Marshal(fs)
+
+		require.NoError(t, err)
+		assert.Equal(t, string(buf), `{"Value":"{\"some\":}"}`)
+	})
+	t.Run("any valid json is embedded", func(t *testing.T) {
+		for value, expected := range map[FlexiString]string{
+			`[1,{"a":"b"}]`: `{"Value":[1,{"a":"b"}]}`,
+			`42`:            `{"Value":42}`,
+			`-1.5e3`:        `{"Value":-1.5e3}`,
+			`true`:          `{"Value":true}`,
+			``:              `{"Value":""}`,
+			`[1,`:           `{"Value":"[1,"}`,
+		} {
+			buf, err := json.Marshal(testType{value})
+
+			require.NoError(t, err)
+			assert.Equal(t, expected, string(buf))
+		}
+	})
+	t.Run("it reads back what it wrote", func(t *testing.T) {
+		for _, value := range []FlexiString{`some text`, `{"some":true}`, `[1,2]`, `42`} {
+			buf, err := json.Marshal(testType{value})
+			require.NoError(t, err)
+			var decoded testType
+
+			require.NoError(t, json.Unmarshal(buf, &decoded))
+			assert.Equal(t, value, decoded.Value)
+		}
+	})
+}
+
+func Test_message_timestamps_are_formatted_with_their_age(t *testing.T) {
+	defer func() { now = time.Now }()
+	now = func() time.Time { return FromUnixMilli(1574340442983).Add(90 * time.Second) }
+
+	messages := SimplifyMessages(&sqs.ReceiveMessageOutput{Messages: []*sqs.Message{{
+		Attributes: map[string]*string{sqs.MessageSystemAttributeNameSentTimestamp: aws.String("1574340442983")},
+	}}}, time.UTC)
+
+	require.Len(t, messages, 1)
+	assert.Equal(t, "2019-11-21T12:47:22.983Z", messages[0].AwsAttrib["_SentTimestamp"])
+	assert.Equal(t, "1m30s ago", messages[0].AwsAttrib["_SentTimestampAge"])
+}
@@ -0,0 +1,109 @@
+package queue
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+)
+
+// ReceiveOptions controls how messages are received, the zero value hides them for 20 seconds
+type ReceiveOptions struct {
+	// VisibilityTimeout in seconds, each message is hidden from other consumers for this long
+	VisibilityTimeout int64
+	// Concurrency is the number of receivers Read runs, 10 when zero
+	Concurrency int
+	// Window, when set, releases messages sent outside it straight away instead of sending them on
+	Window *SentWindow
+	// OnReceive, when set, is called with each batch before it is sent on, e.g. to start extending visibility
+	OnReceive func(messages ...Message)
+	// Location shows the formatted timestamps in that zone, see FormatTime
+	Location *time.Location
+}
+
+// Receive sends batches to out until the queue is empty or ctx is cancelled,
+// or with a Window until only messages already released are received.
+// Errors are sent to errs and receiving carries on
+func Receive(ctx context.Context, svc sqsiface.SQSAPI, queueURL string, options ReceiveOptions, out chan<- []Message, errs chan<- error) {
+	var visibility int64 = 20
+	if options.VisibilityTimeout > 0 {
+		visibility = options.VisibilityTimeout
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+			result, err := svc.ReceiveMessageWithContext(ctx,
+				&sqs.ReceiveMessageInput{
+					AttributeNames: []*string{
+						aws.String(sqs.MessageSystemAttributeNameSentTimestamp),
+						aws.String(sqs.MessageSystemAttributeNameApproximateReceiveCount),
+						aws.String(sqs.MessageSystemAttributeNameApproximateFirstReceiveTimestamp),
+						aws.String(sqs.MessageSystemAttributeNameMessageGroupId),
+						aws.String(sqs.MessageSystemAttributeNameMessageDeduplicationId),
+					},
+					MessageAttributeNames: []*string{
+						aws.String(sqs.QueueAttributeNameAll),
+					},
+					QueueUrl:            aws.String(queueURL),
+					MaxNumberOfMessages: aws.Int64(10),
+					VisibilityTimeout:   aws.Int64(visibility),
+					WaitTimeSeconds:     aws.Int64(0),
+				})
+
+			if err == nil {
+				if len(result.Messages) == 0 {
+					return
+				}
+				messages, outside, seen := options.Window.split(SimplifyMessages(result, options.Location))
+				if len(outside) > 0 {
+					if err := Release(ctx, svc, queueURL, outside...); err != nil {
+						errs <- err
+					}
+					// released messages come straight back, once only those are received everything has been seen
+					if len(messages) == 0 && seen {
+						return
+					}
+				}
+				if len(messages) == 0 {
+					continue
+				}
+				if options.OnReceive != nil {
+					options.OnReceive(messages...)
+				}
+				out <- messages
+			} else {
+				errs <- err
+			}
+		}
+	}
+}
+
+// Read runs Receive concurrently until the queue is empty or ctx is cancelled,
+// both channels are closed once it is done and both must be drained
+func Read(ctx context.Context, svc sqsiface.SQSAPI, queueURL string, options ReceiveOptions) (<-chan []Message, <-chan error) {
+	out := make(chan []Message)
+	errs := make(chan error)
+	concurrency := options.Concurrency
+	if concurrency < 1 {
+		concurrency = 10
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			Receive(ctx, svc, queueURL, options, out, errs)
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(out)
+		close(errs)
+	}()
+	return out, errs
+}
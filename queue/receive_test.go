@@ -0,0 +1,123 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeReceive struct {
+	sqsiface.SQSAPI
+	mu      sync.Mutex
+	pending []*sqs.Message
+	// sent is the SentTimestamp of each message by receipt handle, so released messages can be received again
+	sent     map[string]*string
+	released int
+}
+
+func (f *fakeReceive) ReceiveMessageWithContext(_ aws.Context, input *sqs.ReceiveMessageInput, _ ...request.Option) (*sqs.ReceiveMessageOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := int(aws.Int64Value(input.MaxNumberOfMessages))
+	if n > len(f.pending) {
+		n = len(f.pending)
+	}
+	out := sqs.ReceiveMessageOutput{Messages: f.pending[:n]}
+	f.pending = f.pending[n:]
+	return &out, nil
+}
+
+func Test_read_receives_until_the_queue_is_empty(t *testing.T) {
+	svc := &fakeReceive{}
+	for i := 0; i < 25; i++ {
+		svc.pending = append(svc.pending, &sqs.Message{MessageId: aws.String("id"), Body: aws.String(`{"some":true}`)})
+	}
+	var held int
+	var mu sync.Mutex
+	options := ReceiveOptions{Concurrency: 3, OnReceive: func(messages ...Message) {
+		mu.Lock()
+		defer mu.Unlock()
+		held += len(messages)
+	}}
+
+	messages, errs := Read(context.Background(), svc, "http://any.com/1/orders", options)
+
+	var received []Message
+	for messages != nil || errs != nil {
+		select {
+		case batch, ok := <-messages:
+			if !ok {
+				messages = nil
+				continue
+			}
+			received = append(received, batch...)
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			assert.NoError(t, err)
+		}
+	}
+	assert.Len(t, received, 25)
+	assert.Equal(t, 25, held)
+	assert.Equal(t, ContentTypeJSON, received[0].ContentType)
+	assert.NotNil(t, received[0].Raw)
+}
+
+func (f *fakeReceive) ChangeMessageVisibilityBatchWithContext(_ aws.Context, input *sqs.ChangeMessageVisibilityBatchInput, _ ...request.Option) (*sqs.ChangeMessageVisibilityBatchOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, e := range input.Entries {
+		f.released++
+		f.pending = append(f.pending, &sqs.Message{
+			MessageId:     e.ReceiptHandle,
+			ReceiptHandle: e.ReceiptHandle,
+			Attributes:    map[string]*string{sqs.MessageSystemAttributeNameSentTimestamp: f.sent[*e.ReceiptHandle]},
+		})
+	}
+	return &sqs.ChangeMessageVisibilityBatchOutput{}, nil
+}
+
+func Test_messages_sent_outside_the_window_are_released(t *testing.T) {
+	start := time.Date(2019, 11, 21, 12, 0, 0, 0, time.UTC)
+	svc := &fakeReceive{sent: make(map[string]*string)}
+	for i := 0; i < 30; i++ {
+		id := fmt.Sprintf("m%d", i)
+		sent := aws.String(strconv.FormatInt(start.Add(time.Duration(i)*time.Minute).UnixNano()/int64(time.Millisecond), 10))
+		svc.sent[id] = sent
+		svc.pending = append(svc.pending, &sqs.Message{
+			MessageId:     aws.String(id),
+			ReceiptHandle: aws.String(id),
+			Attributes:    map[string]*string{sqs.MessageSystemAttributeNameSentTimestamp: sent},
+		})
+	}
+	window := &SentWindow{After: start.Add(10 * time.Minute), Before: start.Add(20 * time.Minute)}
+
+	out := make(chan []Message, 10)
+	errs := make(chan error, 10)
+	Receive(context.Background(), svc, "http://any.com/1/orders", ReceiveOptions{Window: window}, out, errs)
+	close(out)
+
+	var ids []string
+	for batch := range out {
+		for _, m := range batch {
+			ids = append(ids, m.MessageId)
+		}
+	}
+	assert.Len(t, ids, 10)
+	assert.Contains(t, ids, "m10")
+	assert.NotContains(t, ids, "m20")
+	// the 20 outside, then the first batch of those again which ends receiving
+	assert.Equal(t, 30, svc.released)
+	assert.Empty(t, errs)
+}
@@ -0,0 +1,105 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+)
+
+// the most entries SendMessageBatch accepts
+const sendBatchSize = 10
+
+// BatchError lists the messages SendBatch could not send, by message id
+type BatchError struct {
+	Failed map[string]string
+}
+
+func (e *BatchError) Error() string {
+	var ids []string
+	for id := range e.Failed {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	var reasons []string
+	for _, id := range ids {
+		reasons = append(reasons, id+": "+e.Failed[id])
+	}
+	return fmt.Sprintf("failed sending %d messages, %s", len(ids), strings.Join(reasons, ", "))
+}
+
+// SendInput sends the body and typed custom attributes as they were received,
+// the group and deduplication ids are kept for FIFO queues.
+// Messages without Body or TypedAttrib, e.g. edited by hand, send Message with every attribute as a String
+func SendInput(queueURL string, m Message) *sqs.SendMessageInput {
+	input := sqs.SendMessageInput{
+		MessageBody: aws.String(m.Message.String()),
+		QueueUrl:    aws.String(queueURL),
+	}
+	if m.Body != "" {
+		input.MessageBody = aws.String(m.Body)
+	}
+	if m.TypedAttrib != nil {
+		input.MessageAttributes = m.TypedAttrib
+	} else if len(m.CustAttrib) > 0 && len(m.Decoded) == 0 {
+		input.MessageAttributes = make(map[string]*sqs.MessageAttributeValue)
+		for k, v := range m.CustAttrib {
+			input.MessageAttributes[k] = StringAttribute(v)
+		}
+	}
+	// this is only valid for FIFO queues
+	if group, ok := m.AwsAttrib[sqs.MessageSystemAttributeNameMessageGroupId]; ok {
+		input.MessageGroupId = aws.String(group)
+		if dedup, ok := m.AwsAttrib[sqs.MessageSystemAttributeNameMessageDeduplicationId]; ok {
+			input.MessageDeduplicationId = aws.String(dedup)
+		}
+	}
+	return &input
+}
+
+// StringAttribute is a message attribute of type String
+func StringAttribute(value string) *sqs.MessageAttributeValue {
+	return &sqs.MessageAttributeValue{
+		DataType:    aws.String("String"),
+		StringValue: aws.String(value),
+	}
+}
+
+// SendBatch sends messages ten at a time as SendInput would, when only some fail the error is a *BatchError
+func SendBatch(ctx context.Context, svc sqsiface.SQSAPI, queueURL string, messages []Message) error {
+	failed := make(map[string]string)
+	for start := 0; start < len(messages); start += sendBatchSize {
+		end := start + sendBatchSize
+		if end > len(messages) {
+			end = len(messages)
+		}
+		input := sqs.SendMessageBatchInput{QueueUrl: aws.String(queueURL)}
+		for i, m := range messages[start:end] {
+			single := SendInput(queueURL, m)
+			input.Entries = append(input.Entries, &sqs.SendMessageBatchRequestEntry{
+				Id:                     aws.String(strconv.Itoa(i)),
+				MessageBody:            single.MessageBody,
+				MessageAttributes:      single.MessageAttributes,
+				MessageGroupId:         single.MessageGroupId,
+				MessageDeduplicationId: single.MessageDeduplicationId,
+			})
+		}
+		out, err := svc.SendMessageBatchWithContext(ctx, &input)
+		if err != nil {
+			return err
+		}
+		for _, f := range out.Failed {
+			i, _ := strconv.Atoi(aws.StringValue(f.Id))
+			failed[messages[start+i].MessageId] = aws.StringValue(f.Message)
+		}
+	}
+	if len(failed) > 0 {
+		return &BatchError{Failed: failed}
+	}
+	return nil
+}
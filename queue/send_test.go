@@ -0,0 +1,85 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeSend struct {
+	sqsiface.SQSAPI
+	batches []*sqs.SendMessageBatchInput
+	// reject fails every entry with this body
+	reject string
+}
+
+func (f *fakeSend) SendMessageBatchWithContext(_ aws.Context, input *sqs.SendMessageBatchInput, _ ...request.Option) (*sqs.SendMessageBatchOutput, error) {
+	f.batches = append(f.batches, input)
+	var out sqs.SendMessageBatchOutput
+	for _, e := range input.Entries {
+		if aws.StringValue(e.MessageBody) == f.reject {
+			out.Failed = append(out.Failed, &sqs.BatchResultErrorEntry{Id: e.Id, Message: aws.String("rejected")})
+		}
+	}
+	return &out, nil
+}
+
+func Test_messages_are_sent_in_batches(t *testing.T) {
+	var messages []Message
+	for i := 0; i < 12; i++ {
+		messages = append(messages, Message{MessageId: string(rune('a' + i)), Message: "body", CustAttrib: map[string]string{"k": "v"}})
+	}
+	messages[11].Message = "bad"
+	messages[11].AwsAttrib = map[string]string{sqs.MessageSystemAttributeNameMessageGroupId: "group"}
+	svc := &fakeSend{reject: "bad"}
+
+	err := SendBatch(context.Background(), svc, "http://any.com/1/orders", messages)
+
+	require.Len(t, svc.batches, 2)
+	assert.Len(t, svc.batches[0].Entries, 10)
+	assert.Len(t, svc.batches[1].Entries, 2)
+	assert.Equal(t, "v", aws.StringValue(svc.batches[0].Entries[0].MessageAttributes["k"].StringValue))
+	assert.Equal(t, "group", aws.StringValue(svc.batches[1].Entries[1].MessageGroupId))
+	var batchErr *BatchError
+	require.True(t, errors.As(err, &batchErr))
+	assert.Equal(t, map[string]string{"l": "rejected"}, batchErr.Failed)
+}
+
+func Test_a_read_message_is_sent_as_it_was_received(t *testing.T) {
+	envelope := `{"Type":"Notification","TopicArn":"arn:aws:sns:eu-west-1:1:topic","Message":"{\"some\": true}",` +
+		`"MessageAttributes":{"event":{"Type":"String","Value":"created"}}}`
+	count := &sqs.MessageAttributeValue{DataType: aws.String("Number"), StringValue: aws.String("3")}
+	received := SimplifyMessages(&sqs.ReceiveMessageOutput{Messages: []*sqs.Message{
+		{MessageId: aws.String("sns"), Body: aws.String(envelope), MessageAttributes: map[string]*sqs.MessageAttributeValue{"count": count}},
+		{MessageId: aws.String("spaced"), Body: aws.String(`{"some": true}`)},
+		{MessageId: aws.String("plain"), Body: aws.String(`{"some":true}`)},
+	}}, nil)
+	buf, err := json.Marshal(received)
+	require.NoError(t, err)
+	var read []Message
+	require.NoError(t, json.Unmarshal(buf, &read))
+
+	t.Run("decoded bodies are sent as received", func(t *testing.T) {
+		input := SendInput("http://any.com/1/orders", read[0])
+
+		assert.Equal(t, envelope, aws.StringValue(input.MessageBody))
+	})
+	t.Run("attribute types are kept and those from the envelope are not added", func(t *testing.T) {
+		input := SendInput("http://any.com/1/orders", read[0])
+
+		assert.Equal(t, map[string]*sqs.MessageAttributeValue{"count": count}, input.MessageAttributes)
+	})
+	t.Run("json is sent with its original spacing", func(t *testing.T) {
+		assert.Equal(t, `{"some": true}`, aws.StringValue(SendInput("", read[1]).MessageBody))
+		assert.Equal(t, `{"some":true}`, aws.StringValue(SendInput("", read[2]).MessageBody))
+		assert.Empty(t, read[2].Body)
+	})
+}
@@ -1,31 +1,30 @@
-package main
+package queue
 
-import (
-	"fmt"
-	"io/ioutil"
-	"os"
-)
+import "time"
 
+// KeyNameMaxUnique marks an attribute whose values were trimmed as they were all unique
 const KeyNameMaxUnique = "$MAX_UNIQUE_LIMIT_REACHED"
 
 type (
-	timeRange struct {
+	// TimeRange is the earliest and latest value seen for a timestamp attribute
+	TimeRange struct {
 		From    int64  `json:"from"`
 		FromStr string `json:"fromDtm"`
 		To      int64  `json:"to"`
 		ToStr   string `json:"toDtm"`
+		FromAge string `json:"fromAge"`
+		ToAge   string `json:"toAge"`
 	}
-	summary struct {
+	// Summary counts the values of each custom attribute and the range of each timestamp,
+	// call Analyse once every message is added
+	Summary struct {
 		MsgCount   int                       `json:"messageCount"`
 		MsgAttribs map[string]map[string]int `json:"customAttributes"`
-		Timestamps map[string]timeRange      `json:"timestamps"`
-		limit      int
+		Timestamps map[string]TimeRange      `json:"timestamps"`
 	}
 )
 
-const msRFCTimeFormat = "2006-01-02 15:04:05.999"
-
-func (t timeRange) record(value int64) timeRange {
+func (t TimeRange) record(value int64) TimeRange {
 	if t.From == 0 && t.To == 0 {
 		t.From = value
 		t.To = value
@@ -37,26 +36,30 @@ func (t timeRange) record(value int64) timeRange {
 	return t
 }
 
-func (t timeRange) format() timeRange {
-	return timeRange{
+func (t TimeRange) format(loc *time.Location) TimeRange {
+	return TimeRange{
 		From:    t.From,
 		To:      t.To,
-		FromStr: fromUnixMilli(t.From).Format(msRFCTimeFormat),
-		ToStr:   fromUnixMilli(t.To).Format(msRFCTimeFormat),
+		FromStr: FormatTimestamp(t.From, loc),
+		ToStr:   FormatTimestamp(t.To, loc),
+		FromAge: TimestampAge(t.From),
+		ToAge:   TimestampAge(t.To),
 	}
 }
 
-func (s *summary) add(msg []message) {
+// Add adds every message in a batch
+func (s *Summary) Add(msg []Message) {
 	for _, m := range msg {
-		s.addOne(m)
+		s.AddOne(m)
 	}
 }
 
-func (s *summary) addOne(msg message) {
+// AddOne counts the message and its attributes
+func (s *Summary) AddOne(msg Message) {
 	s.MsgCount++
 	if len(s.MsgAttribs) == 0 {
 		s.MsgAttribs = make(map[string]map[string]int)
-		s.Timestamps = make(map[string]timeRange)
+		s.Timestamps = make(map[string]TimeRange)
 	}
 	var ok bool
 	var m map[string]int
@@ -68,22 +71,14 @@ func (s *summary) addOne(msg message) {
 		m[v]++
 	}
 	for k, v := range msg.AwsAttrib {
-		if ok, ts := isTimestamp(k, v); ok {
+		if ok, ts := IsTimestamp(k, v); ok {
 			s.Timestamps[k] = s.Timestamps[k].record(ts)
 		}
 	}
 }
 
-func (s *summary) write(maxUnique int64) {
-	s.analyse(maxUnique)
-	buf, _ := jsonMarshal(s)
-	err := ioutil.WriteFile("summary.json", buf, 0666)
-	if err != nil {
-		_, _ = fmt.Fprintf(os.Stderr, "ERROR:failed summary.json %v", err)
-	}
-}
-
-func (s *summary) analyse(maxUnique int64) {
+// Analyse trims attributes with more than maxUnique values that are all unique, and formats the timestamps in loc
+func (s *Summary) Analyse(maxUnique int64, loc *time.Location) {
 	for k, v := range s.MsgAttribs {
 		if len(v) == s.MsgCount && int64(s.MsgCount) > maxUnique {
 			trimmed := make(map[string]int)
@@ -99,6 +94,6 @@ func (s *summary) analyse(maxUnique int64) {
 		}
 	}
 	for k := range s.Timestamps {
-		s.Timestamps[k] = s.Timestamps[k].format()
+		s.Timestamps[k] = s.Timestamps[k].format(loc)
 	}
 }
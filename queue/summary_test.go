@@ -1,4 +1,4 @@
-package main
+package queue
 
 import (
 	"fmt"
@@ -20,58 +20,58 @@ func Test_a_single_message_can_be_simplified(t *testing.T) {
 			withMsgAttr(kv{k: "msgK1", v: "msgV1"}).
 			build(),
 	}
-	actual := simplifyMessage(&awsMsg)
+	actual := SimplifyMessages(&awsMsg, nil)
 
 	require.NotEmpty(t, actual)
-	assert.Equal(t, flexiString("body1"), actual[0].Message)
+	assert.Equal(t, FlexiString("body1"), actual[0].Message)
 	assert.Equal(t, "v1", actual[0].AwsAttrib["k1"])
 	assert.Equal(t, "msgV1", actual[0].CustAttrib["msgK1"])
 }
 
 func Test_a_single_message_can_produce_a_summary(t *testing.T) {
-	msg := message{
+	msg := Message{
 		Message:    "any-message",
 		AwsAttrib:  map[string]string{"ak1": "av1"},
 		CustAttrib: map[string]string{"mk1": "mv1"},
 	}
 
-	sum := summary{}
-	sum.addOne(msg)
-	sum.analyse(anyLimit)
+	sum := Summary{}
+	sum.AddOne(msg)
+	sum.Analyse(anyLimit, nil)
 
 	assert.Equal(t, 1, len(sum.MsgAttribs["mk1"]))
 	assert.Equal(t, 1, sum.MsgAttribs["mk1"]["mv1"])
 }
 
 func Test_when_multiple_messages_are_processed(t *testing.T) {
-	msg := func(k, v string) message {
-		return message{
+	msg := func(k, v string) Message {
+		return Message{
 			CustAttrib: map[string]string{k: v},
 		}
 	}
 	t.Run("with identical keys", func(t *testing.T) {
 		t.Run("if the values From a non-unique finite set there is a count of the kv pair for the key", func(t *testing.T) {
-			sum := summary{}
-			sum.addOne(msg("k1", "v1"))
-			sum.addOne(msg("k1", "v1"))
-			sum.addOne(msg("k1", "v2"))
-			sum.analyse(anyLimit)
+			sum := Summary{}
+			sum.AddOne(msg("k1", "v1"))
+			sum.AddOne(msg("k1", "v1"))
+			sum.AddOne(msg("k1", "v2"))
+			sum.Analyse(anyLimit, nil)
 
 			assert.Equal(t, 2, len(sum.MsgAttribs["k1"]))
 			assert.Equal(t, 2, sum.MsgAttribs["k1"]["v1"])
 			assert.Equal(t, 1, sum.MsgAttribs["k1"]["v2"])
 		})
 		t.Run("if the number of unique values hits a limit, the values upto the limit and a  marker event is returned", func(t *testing.T) {
-			sum := summary{}
+			sum := Summary{}
 			const maxUnique int = 6
 			var values []string
 			for i := 0; i < maxUnique+1; i++ {
 				v := fmt.Sprintf("v%d", i)
 				values = append(values, v)
-				sum.addOne(msg("k1", v))
+				sum.AddOne(msg("k1", v))
 			}
 
-			sum.analyse(int64(maxUnique))
+			sum.Analyse(int64(maxUnique), nil)
 
 			require.Equal(t, 1, len(sum.MsgAttribs))
 			assert.Equal(t, maxUnique+1, len(sum.MsgAttribs["k1"]))
@@ -83,11 +83,11 @@ func Test_when_multiple_messages_are_processed(t *testing.T) {
 	})
 	t.Run("with unique keys", func(t *testing.T) {
 		t.Run("if the values are equal there is a count for the key", func(t *testing.T) {
-			sum := summary{}
-			sum.addOne(msg("k1", "any-value"))
-			sum.addOne(msg("k2", "any-value"))
-			sum.addOne(msg("k3", "any-value"))
-			sum.analyse(anyLimit)
+			sum := Summary{}
+			sum.AddOne(msg("k1", "any-value"))
+			sum.AddOne(msg("k2", "any-value"))
+			sum.AddOne(msg("k3", "any-value"))
+			sum.Analyse(anyLimit, nil)
 
 			assert.Equal(t, 1, len(sum.MsgAttribs["k1"]))
 			assert.Equal(t, 1, sum.MsgAttribs["k1"]["any-value"])
@@ -100,16 +100,16 @@ func Test_when_multiple_messages_are_processed(t *testing.T) {
 }
 
 func Test_when_analyse_is_called_string_version_of_timestamps_are_set(t *testing.T) {
-	sum := summary{}
+	sum := Summary{}
 	var dtm int64 = 1574154612615
 	var dtmStr = "2019-11-19 09:10:12.615"
 
-	sum.addOne(message{
+	sum.AddOne(Message{
 		AwsAttrib: map[string]string{
 			"SentTimestamp": "1574154612615",
 		},
 	})
-	sum.analyse(anyLimit)
+	sum.Analyse(anyLimit, nil)
 
 	assert.Equal(t, dtm, sum.Timestamps["SentTimestamp"].From)
 	assert.Equal(t, dtm, sum.Timestamps["SentTimestamp"].To)
@@ -0,0 +1,104 @@
+package queue
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// TimestampFormat is how timestamps are shown next to the raw epoch values without a location
+	TimestampFormat = "2006-01-02 15:04:05.999"
+	// ZonedTimestampFormat is RFC3339 with milliseconds, used with a location
+	ZonedTimestampFormat = "2006-01-02T15:04:05.999Z07:00"
+	// AgeSuffix is added to the formatted timestamp attribute name for how long ago it was, e.g. _SentTimestampAge
+	AgeSuffix = "Age"
+)
+
+// now is replaced in tests so ages are predictable
+var now = time.Now
+
+// ParseLocation accepts UTC, local or an IANA name such as Europe/London
+func ParseLocation(name string) (*time.Location, error) {
+	switch strings.ToLower(name) {
+	case "utc":
+		return time.UTC, nil
+	case "local":
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time zone %q, use UTC, local or a name such as Europe/London: %v", name, err)
+	}
+	return loc, nil
+}
+
+// FormatTimestamp formats an epoch in seconds or milliseconds, see FormatTime
+func FormatTimestamp(ts int64, loc *time.Location) string {
+	return FormatTime(timeOf(ts), loc)
+}
+
+// FormatTime shows t in loc with its offset, a nil loc shows t as given without one
+func FormatTime(t time.Time, loc *time.Location) string {
+	if loc == nil {
+		return t.Format(TimestampFormat)
+	}
+	return t.In(loc).Format(ZonedTimestampFormat)
+}
+
+// TimestampAge is how long ago an epoch in seconds or milliseconds was, e.g. 3h12m ago
+func TimestampAge(ts int64) string {
+	return FormatAge(now().Sub(timeOf(ts)))
+}
+
+// FormatAge shows the two largest units of an age, e.g. 45s, 12m5s, 3h12m or 2d4h followed by ago
+func FormatAge(age time.Duration) string {
+	if age < 0 {
+		age = 0
+	}
+	age = age.Round(time.Second)
+	days := age / (24 * time.Hour)
+	hours := age % (24 * time.Hour) / time.Hour
+	minutes := age % time.Hour / time.Minute
+	seconds := age % time.Minute / time.Second
+	switch {
+	case days > 0:
+		return fmt.Sprintf("%dd%dh ago", days, hours)
+	case hours > 0:
+		return fmt.Sprintf("%dh%dm ago", hours, minutes)
+	case minutes > 0:
+		return fmt.Sprintf("%dm%ds ago", minutes, seconds)
+	}
+	return fmt.Sprintf("%ds ago", seconds)
+}
+
+func timeOf(ts int64) time.Time {
+	dtm := time.Unix(ts, 0)
+	if dtm.Year() > 9999 {
+		// a ms timestamp
+		dtm = FromUnixMilli(ts)
+	}
+	return dtm
+}
+
+// IsTimestamp is true for attributes named *Timestamp holding an epoch, which it returns
+func IsTimestamp(key, value string) (bool, int64) {
+	if !strings.HasSuffix(key, "Timestamp") {
+		return false, 0
+	}
+	ts, err := strconv.ParseInt(value, 10, 0)
+	if err != nil {
+		return false, 0
+	}
+	return true, ts
+}
+
+// From https://github.com/Tigraine/go-timemilli/blob/master/timemilli.go
+const millisInSecond = 1000
+const nsInSecond = 1000000
+
+// FromUnixMilli converts Unix Epoch From milliseconds To time.Time
+func FromUnixMilli(ms int64) time.Time {
+	return time.Unix(ms/int64(millisInSecond), (ms%int64(millisInSecond))*int64(nsInSecond))
+}
@@ -0,0 +1,124 @@
+package queue
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_a_single_timestamp_sets_to_and_from(t *testing.T) {
+	const key = "ApproximateFirstReceiveTimestamp"
+	var dtm int64 = 1574154612615
+	dtmStr := "1574154612615"
+	fmtDtm := "2019-11-19 09:10:12.615"
+
+	sum := Summary{}
+	sum.AddOne(Message{AwsAttrib: map[string]string{
+		key: dtmStr,
+	}})
+
+	assert.Equal(t, dtm, sum.Timestamps[key].From)
+	assert.Equal(t, dtm, sum.Timestamps[key].To)
+
+	sum.Analyse(anyLimit, nil)
+
+	assert.Equal(t, fmtDtm, sum.Timestamps[key].FromStr)
+	assert.Equal(t, fmtDtm, sum.Timestamps[key].ToStr)
+}
+
+func Test_recording_a_timestamp(t *testing.T) {
+	t.Run("when value is empty a new timeRange is returned with both To and From are set", func(t *testing.T) {
+		ts := TimeRange{}
+		const aValue int64 = 1
+		ts = ts.record(aValue)
+
+		assert.Equal(t, aValue, ts.From)
+		assert.Equal(t, aValue, ts.To)
+	})
+
+	t.Run("when value before both non-zero values, only 'From' is set in response", func(t *testing.T) {
+		now := time.Now()
+		ts := TimeRange{}.record(now.Unix())
+		beforeAll := now.Add(-10 * time.Second)
+		ts = ts.record(beforeAll.Unix())
+
+		assert.Equal(t, beforeAll.Unix(), ts.From)
+		assert.Equal(t, now.Unix(), ts.To)
+	})
+
+	t.Run("when value after both non-zero values, only 'To' is set in response", func(t *testing.T) {
+		now := time.Now()
+		ts := TimeRange{}.record(now.Unix())
+		afterAll := now.Add(10 * time.Second)
+		ts = ts.record(afterAll.Unix())
+
+		assert.Equal(t, now.Unix(), ts.From)
+		assert.Equal(t, afterAll.Unix(), ts.To)
+	})
+
+	t.Run("when value between both non-zero values there is no change in response", func(t *testing.T) {
+		now := time.Now()
+		ts := TimeRange{}.record(now.Unix())
+		nowPlus10Seconds := now.Add(10 * time.Second)
+		ts = ts.record(nowPlus10Seconds.Unix())
+
+		nowPlus5Seconds := now.Add(5 * time.Second)
+		ts = ts.record(nowPlus5Seconds.Unix())
+
+		assert.Equal(t, now.Unix(), ts.From)
+		assert.Equal(t, nowPlus10Seconds.Unix(), ts.To)
+	})
+}
+
+func Test_FormatTimestamp_works_with_ms_values(t *testing.T) {
+	assert.Equal(t, "2019-11-21 12:47:22.983", FormatTimestamp(1574340442983, nil))
+}
+func Test_FormatTimestamp_works_with_sec_values(t *testing.T) {
+	assert.Equal(t, "2019-11-21 12:47:22", FormatTimestamp(1574340442, nil))
+}
+
+func Test_timestamps_can_be_shown_in_a_time_zone(t *testing.T) {
+	t.Run("utc and local are accepted in any case", func(t *testing.T) {
+		loc, err := ParseLocation("utc")
+		assert.NoError(t, err)
+		assert.Equal(t, time.UTC, loc)
+		loc, err = ParseLocation("Local")
+		assert.NoError(t, err)
+		assert.Equal(t, time.Local, loc)
+	})
+	t.Run("a named zone is written as RFC3339 with its offset", func(t *testing.T) {
+		loc, err := ParseLocation("America/New_York")
+		assert.NoError(t, err)
+
+		assert.Equal(t, "2019-11-21T07:47:22.983-05:00", FormatTimestamp(1574340442983, loc))
+	})
+	t.Run("utc is written with a Z", func(t *testing.T) {
+		assert.Equal(t, "2019-11-21T12:47:22Z", FormatTimestamp(1574340442, time.UTC))
+	})
+	t.Run("an unknown zone is an error", func(t *testing.T) {
+		_, err := ParseLocation("Mars/Olympus")
+		assert.Error(t, err)
+	})
+}
+
+func Test_ages_show_the_two_largest_units(t *testing.T) {
+	tests := map[time.Duration]string{
+		-time.Second:                      "0s ago",
+		45 * time.Second:                  "45s ago",
+		12*time.Minute + 5*time.Second:    "12m5s ago",
+		3*time.Hour + 12*time.Minute:      "3h12m ago",
+		50*time.Hour + 30*time.Minute:     "2d2h ago",
+		time.Hour + 1500*time.Millisecond: "1h0m ago",
+	}
+	for age, expected := range tests {
+		assert.Equal(t, expected, FormatAge(age), age.String())
+	}
+	t.Run("an epoch is compared to now", func(t *testing.T) {
+		defer func() { now = time.Now }()
+		now = func() time.Time { return FromUnixMilli(1574340442983).Add(3*time.Hour + 12*time.Minute) }
+
+		assert.Equal(t, "3h12m ago", TimestampAge(1574340442983))
+		assert.Equal(t, "3h12m ago", TimestampAge(1574340442))
+	})
+}
@@ -0,0 +1,102 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+)
+
+// the most entries ChangeMessageVisibilityBatch accepts
+const releaseBatchSize = 10
+
+// SentWindow selects messages by their SentTimestamp, a zero After or Before is open ended.
+// Share one window between receivers of a queue so messages released by one are known to all.
+type SentWindow struct {
+	After  time.Time
+	Before time.Time
+	mu     sync.Mutex
+	// released is every message id put back as outside the window
+	released map[string]bool
+}
+
+// Contains is true when the message was sent within the window, or has no SentTimestamp
+func (w *SentWindow) Contains(m Message) bool {
+	if w == nil {
+		return true
+	}
+	ok, ts := IsTimestamp(sqs.MessageSystemAttributeNameSentTimestamp, m.AwsAttrib[sqs.MessageSystemAttributeNameSentTimestamp])
+	if !ok {
+		return true
+	}
+	sent := timeOf(ts)
+	if !w.After.IsZero() && sent.Before(w.After) {
+		return false
+	}
+	if !w.Before.IsZero() && !sent.Before(w.Before) {
+		return false
+	}
+	return true
+}
+
+// split separates messages outside the window, seen is true when every one of those was released before
+func (w *SentWindow) split(messages []Message) (in, out []Message, seen bool) {
+	if w == nil {
+		return messages, nil, false
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.released == nil {
+		w.released = make(map[string]bool)
+	}
+	seen = true
+	for _, m := range messages {
+		if w.Contains(m) {
+			in = append(in, m)
+			continue
+		}
+		out = append(out, m)
+		seen = seen && w.released[m.MessageId]
+		w.released[m.MessageId] = true
+	}
+	return in, out, seen
+}
+
+// Release makes received messages visible again straight away
+func Release(ctx context.Context, svc sqsiface.SQSAPI, queueURL string, messages ...Message) error {
+	var handles []*string
+	for _, m := range messages {
+		if m.Raw != nil && m.Raw.ReceiptHandle != nil {
+			handles = append(handles, m.Raw.ReceiptHandle)
+		}
+	}
+	var failed int
+	for start := 0; start < len(handles); start += releaseBatchSize {
+		end := start + releaseBatchSize
+		if end > len(handles) {
+			end = len(handles)
+		}
+		input := sqs.ChangeMessageVisibilityBatchInput{QueueUrl: aws.String(queueURL)}
+		for i, h := range handles[start:end] {
+			input.Entries = append(input.Entries, &sqs.ChangeMessageVisibilityBatchRequestEntry{
+				Id:                aws.String(strconv.Itoa(i)),
+				ReceiptHandle:     h,
+				VisibilityTimeout: aws.Int64(0),
+			})
+		}
+		out, err := svc.ChangeMessageVisibilityBatchWithContext(ctx, &input)
+		if err != nil {
+			return err
+		}
+		failed += len(out.Failed)
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed releasing %d messages, they reappear after the visibility timeout", failed)
+	}
+	return nil
+}
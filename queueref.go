@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/NearlyUnique/awsqueue/queue"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+// queueRef addresses a single Queue directly so it can be used without ListQueues
+type queueRef struct {
+	url     string
+	name    string
+	account string
+	// region is taken from an ARN or url and is empty when unknown
+	region string
+}
+
+// queueUrlRegion matches sqs.<region>.amazonaws.com and the legacy <region>.queue.amazonaws.com,
+// legacy queue.amazonaws.com urls are in us-east-1
+var queueUrlRegion = regexp.MustCompile(`^https?://(?:sqs\.([a-z0-9-]+)|([a-z0-9-]+)\.queue|(queue))\.amazonaws\.com(\.cn)?/`)
+
+// parseQueueRef accepts a url or ARN as queueURL, or a name with an optional owner account
+func parseQueueRef(queueURL, name, account string) (queueRef, error) {
+	if queueURL != "" && name != "" {
+		return queueRef{}, errors.New("cannot specify both --queue-url and --queue-name")
+	}
+	if account != "" && name == "" {
+		return queueRef{}, errors.New("--owner-account needs --queue-name")
+	}
+	if strings.HasPrefix(queueURL, "arn:") {
+		parsed, err := arn.Parse(queueURL)
+		if err != nil {
+			return queueRef{}, fmt.Errorf("invalid queue ARN %q: %v", queueURL, err)
+		}
+		if parsed.Service != sqs.ServiceName || parsed.Resource == "" {
+			return queueRef{}, fmt.Errorf("not an SQS queue ARN: %q", queueURL)
+		}
+		return queueRef{name: parsed.Resource, account: parsed.AccountID, region: parsed.Region}, nil
+	}
+	ref := queueRef{url: queueURL, name: name, account: account}
+	if m := queueUrlRegion.FindStringSubmatch(queueURL); m != nil {
+		ref.region = m[1] + m[2]
+		if m[3] != "" {
+			ref.region = endpoints.UsEast1RegionID
+		}
+	}
+	return ref, nil
+}
+
+// queueRefOf takes a url, ARN or plain queue name
+func queueRefOf(queue, account string) (queueRef, error) {
+	if strings.HasPrefix(queue, "arn:") || strings.Contains(queue, "://") {
+		return parseQueueRef(queue, "", account)
+	}
+	return parseQueueRef("", queue, account)
+}
+
+func (ref queueRef) isSet() bool {
+	return ref.url != "" || ref.name != ""
+}
+
+// resolve returns the url as given, otherwise looks it up by name and owner account
+func (ref queueRef) resolve(ctx context.Context, svc *sqs.SQS) (string, error) {
+	if ref.url != "" {
+		return ref.url, nil
+	}
+	input := sqs.GetQueueUrlInput{QueueName: aws.String(ref.name)}
+	if ref.account != "" {
+		input.QueueOwnerAWSAccountId = aws.String(ref.account)
+	}
+	out, err := svc.GetQueueUrlWithContext(ctx, &input)
+	if err != nil {
+		return "", fmt.Errorf("failed resolving queue %s: %v", ref.name, err)
+	}
+	return aws.StringValue(out.QueueUrl), nil
+}
+
+// aliasURL is the config alias named by --filter, for commands on a single Queue it is used as --queue-url
+// so the Queue is described directly and nothing else in the account is listed
+func aliasURL(flags cliFlags, action CmdAction) string {
+	if flags.queueURL != "" || flags.queueName != "" || flags.multi {
+		return ""
+	}
+	switch action {
+	case CmdActionList, CmdActionTopology, CmdActionCheck, CmdActionBrowse, CmdActionMetrics, CmdActionDiff:
+		return ""
+	}
+	return flags.aliases[flags.filter]
+}
+
+// describeQueue reads the attributes of just the one Queue, for commands that show or copy them
+func describeQueue(options listQueueOptions, queueURL string) (QueueSearchResult, error) {
+	list := options.queueListOptions()
+	list.Filter = ""
+	list.Tags = nil
+	list.AllMessages = true
+	return queue.Describe(options.ctx, options.svc, list, queueURL)
+}
+
+// needsQueueAttrs is false for commands that only need the url of a directly addressed Queue,
+// an archive manifest records the queue attributes so reading into one needs them
+func needsQueueAttrs(action CmdAction, archive bool) bool {
+	if archive {
+		return true
+	}
+	switch action {
+	case CmdActionRead, CmdActionWrite, CmdActionRestore, CmdActionPurge, CmdActionTag, CmdActionMove, CmdActionRoute, CmdActionExec:
+		return false
+	}
+	return true
+}
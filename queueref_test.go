@@ -0,0 +1,76 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_parsing_a_queue_reference(t *testing.T) {
+	t.Run("url keeps its region", func(t *testing.T) {
+		ref, err := parseQueueRef("https://sqs.eu-west-2.amazonaws.com/123456789012/orders", "", "")
+		require.NoError(t, err)
+		assert.Equal(t, queueRef{url: "https://sqs.eu-west-2.amazonaws.com/123456789012/orders", region: "eu-west-2"}, ref)
+	})
+	t.Run("legacy urls keep their region", func(t *testing.T) {
+		ref, err := parseQueueRef("https://eu-west-1.queue.amazonaws.com/123456789012/orders", "", "")
+		require.NoError(t, err)
+		assert.Equal(t, "eu-west-1", ref.region)
+
+		ref, err = parseQueueRef("https://queue.amazonaws.com/123456789012/orders", "", "")
+		require.NoError(t, err)
+		assert.Equal(t, "us-east-1", ref.region)
+	})
+	t.Run("local endpoint url has no region", func(t *testing.T) {
+		ref, err := parseQueueRef("http://localhost:4566/000000000000/orders", "", "")
+		require.NoError(t, err)
+		assert.Equal(t, "", ref.region)
+		assert.True(t, ref.isSet())
+	})
+	t.Run("ARN resolves by name and account", func(t *testing.T) {
+		ref, err := parseQueueRef("arn:aws:sqs:us-east-1:123456789012:orders.fifo", "", "")
+		require.NoError(t, err)
+		assert.Equal(t, queueRef{name: "orders.fifo", account: "123456789012", region: "us-east-1"}, ref)
+	})
+	t.Run("name with owner account", func(t *testing.T) {
+		ref, err := parseQueueRef("", "orders", "123456789012")
+		require.NoError(t, err)
+		assert.Equal(t, queueRef{name: "orders", account: "123456789012"}, ref)
+	})
+	t.Run("nothing given", func(t *testing.T) {
+		ref, err := parseQueueRef("", "", "")
+		require.NoError(t, err)
+		assert.False(t, ref.isSet())
+	})
+	t.Run("invalid", func(t *testing.T) {
+		for _, args := range [][3]string{
+			{"arn:aws:sns:us-east-1:123456789012:orders", "", ""},
+			{"arn:aws:sqs", "", ""},
+			{"https://sqs.eu-west-1.amazonaws.com/123/orders", "orders", ""},
+			{"", "", "123456789012"},
+		} {
+			_, err := parseQueueRef(args[0], args[1], args[2])
+			assert.Error(t, err, args)
+		}
+	})
+}
+
+func Test_only_some_commands_describe_a_direct_queue(t *testing.T) {
+	assert.False(t, needsQueueAttrs(CmdActionRead, false))
+	assert.False(t, needsQueueAttrs(CmdActionPurge, false))
+	assert.True(t, needsQueueAttrs(CmdActionClone, false))
+	assert.True(t, needsQueueAttrs(CmdActionSetAttrs, false))
+	assert.True(t, needsQueueAttrs(CmdActionRead, true), "the archive manifest records them")
+}
+
+func Test_an_alias_addresses_a_single_queue_directly(t *testing.T) {
+	flags := cliFlags{filter: "orders-dlq", aliases: map[string]string{"orders-dlq": "https://sqs.eu-west-2.amazonaws.com/1/orders-dlq"}}
+
+	assert.Equal(t, "https://sqs.eu-west-2.amazonaws.com/1/orders-dlq", aliasURL(flags, CmdActionSetAttrs))
+	assert.Equal(t, "https://sqs.eu-west-2.amazonaws.com/1/orders-dlq", aliasURL(flags, CmdActionClone))
+	assert.Empty(t, aliasURL(flags, CmdActionList), "listing still filters")
+
+	flags.queueName = "orders"
+	assert.Empty(t, aliasURL(flags, CmdActionRead), "an explicit queue wins")
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/NearlyUnique/awsqueue/queue"
+)
+
+type (
+	// multiSummary is the summary of every Queue read together, then broken down per Queue
+	multiSummary struct {
+		summary
+		Queues map[string]*summary `json:"queues"`
+	}
+	queueRead struct {
+		name    string
+		results readQueueResult
+		sum     summary
+		err     error
+	}
+)
+
+// readQueues reads every Queue concurrently, writing result-<name>.json per Queue and one summary.json
+func readQueues(options readQueueOptions, queues []map[string]flexiString) error {
+	if len(queues) == 0 {
+		return errors.New("no queue found, change --filter")
+	}
+	reads := make([]queueRead, len(queues))
+	var wg sync.WaitGroup
+	for i, attr := range queues {
+		wg.Add(1)
+		go func(i int, attr map[string]flexiString) {
+			defer wg.Done()
+			opts := options
+			opts.queueURL = attr[queue.AttrKeyQueueUrl].String()
+			opts.queueAttrs = attr
+			opts.msg = make(chan []message)
+			opts.err = make(chan error)
+			opts.wg = &sync.WaitGroup{}
+			if options.archiveDir != "" {
+				opts.archiveDir = filepath.Join(options.archiveDir, attr[queue.AttrKeyQueueName].String())
+			}
+			reads[i].name = attr[queue.AttrKeyQueueName].String()
+			reads[i].results, reads[i].sum, reads[i].err = readQueue(opts)
+		}(i, attr)
+	}
+	wg.Wait()
+
+	sort.Slice(reads, func(i, j int) bool { return reads[i].name < reads[j].name })
+	var failed []string
+	for _, r := range reads {
+		r.results.write(resultFileName(r.name))
+		if r.err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", r.name, r.err))
+		}
+	}
+	combined := combineSummaries(reads, options.maxUnique, options.location)
+	buf, _ := jsonMarshal(combined)
+	if err := ioutil.WriteFile("summary.json", buf, 0666); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "ERROR:failed summary.json %v", err)
+	}
+	writeReadCounts(os.Stdout, combined)
+	if len(failed) > 0 {
+		return fmt.Errorf("failed reading %d queues:\n%s", len(failed), strings.Join(failed, "\n"))
+	}
+	return nil
+}
+
+func resultFileName(queueName string) string {
+	return fmt.Sprintf("result-%s.json", queueName)
+}
+
+func combineSummaries(reads []queueRead, maxUnique int64, loc *time.Location) multiSummary {
+	combined := multiSummary{Queues: make(map[string]*summary)}
+	for i := range reads {
+		combined.Add(reads[i].results.Messages)
+		sum := reads[i].sum
+		sum.Analyse(maxUnique, loc)
+		combined.Queues[reads[i].name] = &sum
+	}
+	combined.Analyse(maxUnique, loc)
+	return combined
+}
+
+func writeReadCounts(w io.Writer, combined multiSummary) {
+	names := make([]string, 0, len(combined.Queues))
+	for name := range combined.Queues {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		count := combined.Queues[name].MsgCount
+		if count == 0 {
+			_, _ = fmt.Fprintf(w, "%5d %s\n", count, name)
+			continue
+		}
+		_, _ = fmt.Fprintf(w, "%5d %s -> %s\n", count, name, resultFileName(name))
+	}
+	_, _ = fmt.Fprintf(w, "%5d total\n", combined.MsgCount)
+}
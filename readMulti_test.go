@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_combining_summaries_of_several_queues(t *testing.T) {
+	read := func(name string, types ...string) queueRead {
+		r := queueRead{name: name}
+		for _, typ := range types {
+			m := message{CustAttrib: map[string]string{"type": typ}, AwsAttrib: map[string]string{}}
+			r.results.add([]message{m})
+			r.sum.AddOne(m)
+		}
+		return r
+	}
+	combined := combineSummaries([]queueRead{
+		read("orders-dlq", "created", "created"),
+		read("billing-dlq", "created", "refund"),
+		read("audit-dlq"),
+	}, 1000, nil)
+
+	assert.Equal(t, 4, combined.MsgCount)
+	assert.Equal(t, map[string]int{"created": 3, "refund": 1}, combined.MsgAttribs["type"])
+	require.Len(t, combined.Queues, 3)
+	assert.Equal(t, 2, combined.Queues["orders-dlq"].MsgCount)
+	assert.Equal(t, map[string]int{"created": 1, "refund": 1}, combined.Queues["billing-dlq"].MsgAttribs["type"])
+	assert.Equal(t, 0, combined.Queues["audit-dlq"].MsgCount)
+
+	t.Run("json keeps the combined counts at the top", func(t *testing.T) {
+		buf, err := jsonMarshal(combined)
+		require.NoError(t, err)
+		var decoded map[string]interface{}
+		require.NoError(t, json.Unmarshal(buf, &decoded))
+		assert.Equal(t, float64(4), decoded["messageCount"])
+		assert.Contains(t, decoded["queues"], "billing-dlq")
+	})
+	t.Run("counts per queue", func(t *testing.T) {
+		var buf bytes.Buffer
+		writeReadCounts(&buf, combined)
+		assert.Equal(t, ""+
+			"    0 audit-dlq\n"+
+			"    2 billing-dlq -> result-billing-dlq.json\n"+
+			"    2 orders-dlq -> result-orders-dlq.json\n"+
+			"    4 total\n", buf.String())
+	})
+}
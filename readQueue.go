@@ -2,148 +2,166 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/NearlyUnique/awsqueue/queue"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
 )
 
 type (
 	readQueueOptions struct {
-		svc               *sqs.SQS
+		svc               sqsiface.SQSAPI
 		queueURL          string
 		visibilityTimeout int64
 		maxUnique         int64
-		msg               chan []message
-		err               chan error
-		ctx               context.Context
-		wg                *sync.WaitGroup
+		archiveDir        string
+		queueAttrs        map[string]flexiString
+		// visibility, when set, tracks every message from the moment it is received
+		visibility *visibilityManager
+		// window, when set, releases messages sent outside --sent-after and --sent-before straight away
+		window *queue.SentWindow
+		// location shows timestamps in --tz
+		location *time.Location
+		msg      chan []message
+		err      chan error
+		ctx      context.Context
+		wg       *sync.WaitGroup
 	}
 	readQueueResult struct {
 		Extracted string    `json:"extracted"`
 		Queue     string    `json:"queueUrl"`
 		Messages  []message `json:"messages"`
 	}
-	message struct {
-		CustAttrib map[string]string `json:"customAttributes"`
-		AwsAttrib  map[string]string `json:"awsAttributes"`
-		Message    flexiString       `json:"message"`
-	}
+	// the core types live in the queue package
+	message = queue.Message
+	summary = queue.Summary
 )
 
 func readQueueData(opts readQueueOptions) {
 	defer opts.wg.Done()
-	for {
-		select {
-		case <-opts.ctx.Done():
-			return
-		default:
-			var visibility int64 = 20
-			if opts.visibilityTimeout > 0 {
-				visibility = opts.visibilityTimeout
-			}
-			result, err := opts.svc.ReceiveMessageWithContext(opts.ctx,
-				&sqs.ReceiveMessageInput{
-					AttributeNames: []*string{
-						aws.String(sqs.MessageSystemAttributeNameSentTimestamp),
-						aws.String(sqs.MessageSystemAttributeNameApproximateReceiveCount),
-						aws.String(sqs.MessageSystemAttributeNameApproximateFirstReceiveTimestamp),
-					},
-					MessageAttributeNames: []*string{
-						aws.String(sqs.QueueAttributeNameAll),
-					},
-					QueueUrl:            &opts.queueURL,
-					MaxNumberOfMessages: aws.Int64(10),
-					VisibilityTimeout:   aws.Int64(visibility),
-					WaitTimeSeconds:     aws.Int64(0),
-				})
+	queue.Receive(opts.ctx, opts.svc, opts.queueURL, queue.ReceiveOptions{
+		VisibilityTimeout: opts.visibilityTimeout,
+		Window:            opts.window,
+		OnReceive:         opts.visibility.hold,
+		Location:          opts.location,
+	}, opts.msg, opts.err)
+}
 
-			if err == nil {
-				if len(result.Messages) == 0 {
-					return
-				}
-				opts.msg <- simplifyMessage(result)
-			} else {
-				opts.err <- err
-			}
-		}
+// sentWindow is nil when neither bound is given, each is a time or a duration before now such as 2h
+func sentWindow(after, before string, now time.Time, loc *time.Location) (*queue.SentWindow, error) {
+	if after == "" && before == "" {
+		return nil, nil
+	}
+	var window queue.SentWindow
+	var err error
+	if window.After, err = parseSentTime("--sent-after", after, now, loc); err != nil {
+		return nil, err
+	}
+	if window.Before, err = parseSentTime("--sent-before", before, now, loc); err != nil {
+		return nil, err
+	}
+	if !window.After.IsZero() && !window.Before.IsZero() && !window.After.Before(window.Before) {
+		return nil, errors.New("--sent-after must be before --sent-before")
 	}
+	return &window, nil
 }
 
-func simplifyMessage(input *sqs.ReceiveMessageOutput) []message {
-	var result []message
-	for _, m := range input.Messages {
-		msg := message{
-			AwsAttrib:  make(map[string]string),
-			CustAttrib: make(map[string]string),
-		}
-		for k, v := range m.Attributes {
-			val := "<nil>"
-			if v != nil {
-				if ok, ts := isTimestamp(k, *v); ok {
-					msg.AwsAttrib["_"+k] = formatTimestamp(ts)
-				}
-				val = *v
-
-			}
-			msg.AwsAttrib[k] = val
-		}
-		for k, v := range m.MessageAttributes {
-			val := "<nil>"
-			if v != nil {
-				val = *v.StringValue
-			}
-			msg.CustAttrib[k] = val
+// parseSentTime accepts RFC3339, a date and time in loc or local time, or a duration such as 90m, 2h or 3d
+func parseSentTime(flag, value string, now time.Time, loc *time.Location) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if days := strings.TrimSuffix(value, "d"); days != value {
+		if n, err := strconv.Atoi(days); err == nil && n >= 0 {
+			return now.AddDate(0, 0, -n), nil
 		}
-		if m.Body != nil {
-			msg.Message = flexiString(*m.Body)
+	}
+	if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+		return now.Add(-d), nil
+	}
+	if loc == nil {
+		loc = time.Local
+	}
+	for _, layout := range []string{time.RFC3339Nano, queue.TimestampFormat, "2006-01-02T15:04:05.999", "2006-01-02 15:04", "2006-01-02T15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t, nil
 		}
-		result = append(result, msg)
 	}
-	return result
+	return time.Time{}, fmt.Errorf("invalid %s %q, use a time such as 2019-11-21T12:00:00Z or a duration ago such as 2h", flag, value)
 }
 
-func readMessages(options readQueueOptions) {
+func readMessages(options readQueueOptions) error {
+	results, sum, err := readQueue(options)
+	results.write("result.json")
+	writeSummary(&sum, options.maxUnique, options.location)
+	return err
+}
+
+// readQueue receives until the Queue is empty or the context is cancelled
+func readQueue(options readQueueOptions) (readQueueResult, summary, error) {
+	results := readQueueResult{
+		Extracted: queue.FormatTime(time.Now().UTC(), options.location),
+		Queue:     options.queueURL,
+	}
+	var sum summary
+	var archive *archiveWriter
+	if options.archiveDir != "" {
+		var err error
+		archive, err = newArchiveWriter(options.archiveDir, options.queueURL, options.queueAttrs, options.location)
+		if err != nil {
+			return results, sum, err
+		}
+	}
 	for i := 0; i < 10; i++ {
 		options.wg.Add(1)
 		go readQueueData(options)
 	}
 	done := signalWaitGroupDone(options.wg)
-	results := readQueueResult{
-		Extracted: time.Now().UTC().Format(msRFCTimeFormat),
-		Queue:     options.queueURL,
-	}
-	var sum summary
-	defer func() {
-		results.write()
-		sum.write(options.maxUnique)
-	}()
 
 	for {
 		select {
 		case <-done:
-			return
+			if archive != nil {
+				return results, sum, archive.close()
+			}
+			return results, sum, nil
 		case err := <-options.err:
 			_, _ = fmt.Fprintf(os.Stderr, "Error:%v\n", err)
 		case msg := <-options.msg:
 			results.add(msg)
-			sum.add(msg)
+			sum.Add(msg)
+			if archive != nil {
+				archive.add(msg)
+			}
 		}
 	}
 }
 
+// writeSummary writes summary.json once the summary is analysed
+func writeSummary(s *summary, maxUnique int64, loc *time.Location) {
+	s.Analyse(maxUnique, loc)
+	buf, _ := jsonMarshal(s)
+	err := ioutil.WriteFile("summary.json", buf, 0666)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "ERROR:failed summary.json %v", err)
+	}
+}
+
 // write json result
-func (r *readQueueResult) write() {
+func (r *readQueueResult) write(file string) {
 	if len(r.Messages) > 0 {
 		buf, err := jsonMarshal(r)
 		if err != nil {
 			_, _ = fmt.Fprintf(os.Stderr, "ERROR:%v\n", err)
 		}
-		err = ioutil.WriteFile("result.json", buf, 0666)
+		err = ioutil.WriteFile(file, buf, 0666)
 		if err != nil {
 			_, _ = fmt.Fprintf(os.Stderr, "ERROR2:%v\n", err)
 		}
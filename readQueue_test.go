@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_sent_window_from_flags(t *testing.T) {
+	now := time.Date(2019, 11, 21, 12, 0, 0, 0, time.UTC)
+
+	t.Run("no bounds is no window", func(t *testing.T) {
+		window, err := sentWindow("", "", now, time.UTC)
+
+		require.NoError(t, err)
+		assert.Nil(t, window)
+	})
+	t.Run("durations are that long before now", func(t *testing.T) {
+		window, err := sentWindow("2d", "90m", now, time.UTC)
+
+		require.NoError(t, err)
+		assert.Equal(t, now.AddDate(0, 0, -2), window.After)
+		assert.Equal(t, now.Add(-90*time.Minute), window.Before)
+	})
+	t.Run("times are in --tz unless they have an offset", func(t *testing.T) {
+		window, err := sentWindow("2019-11-21 10:30", "2019-11-21T12:00:00+01:00", now, time.UTC)
+
+		require.NoError(t, err)
+		assert.Equal(t, time.Date(2019, 11, 21, 10, 30, 0, 0, time.UTC), window.After)
+		assert.True(t, time.Date(2019, 11, 21, 11, 0, 0, 0, time.UTC).Equal(window.Before))
+	})
+	t.Run("either bound can be left open", func(t *testing.T) {
+		window, err := sentWindow("2019-11-20", "", now, time.UTC)
+
+		require.NoError(t, err)
+		assert.Equal(t, time.Date(2019, 11, 20, 0, 0, 0, 0, time.UTC), window.After)
+		assert.True(t, window.Before.IsZero())
+	})
+	t.Run("invalid values and empty windows are errors", func(t *testing.T) {
+		_, err := sentWindow("yesterday", "", now, time.UTC)
+		assert.Error(t, err)
+
+		_, err = sentWindow("1h", "2h", now, time.UTC)
+		assert.EqualError(t, err, "--sent-after must be before --sent-before")
+	})
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"gopkg.in/yaml.v2"
+)
+
+const RouteLeftInPlace = "(left in place)"
+
+type (
+	routeOptions struct {
+		svc               *sqs.SQS
+		queueURL          string
+		table             routeTable
+		visibilityTimeout int64
+		dryRun            bool
+		location          *time.Location
+		ctx               context.Context
+	}
+	// routeTable is read from --routes, the first matching route wins
+	routeTable struct {
+		Routes []route `yaml:"routes"`
+		// Default receives anything matching no route, when empty those messages are left in place
+		Default string `yaml:"default"`
+	}
+	// route matches when every value matches, values may use * and ? wildcards
+	route struct {
+		Name  string `yaml:"name"`
+		Queue string `yaml:"queue"`
+		Match struct {
+			Attributes map[string]string `yaml:"attributes"`
+			Aws        map[string]string `yaml:"aws"`
+			Body       map[string]string `yaml:"body"`
+		} `yaml:"match"`
+		url string
+	}
+	routeCounts struct {
+		routed map[string]int
+		failed map[string]int
+	}
+)
+
+func loadRoutes(file string) (routeTable, error) {
+	var table routeTable
+	buf, err := ioutil.ReadFile(file)
+	if err != nil {
+		return table, err
+	}
+	if err := yaml.UnmarshalStrict(buf, &table); err != nil {
+		return table, fmt.Errorf("failed reading %s: %v", file, err)
+	}
+	if len(table.Routes) == 0 {
+		return table, fmt.Errorf("no routes in %s", file)
+	}
+	for i, r := range table.Routes {
+		if r.Queue == "" {
+			return table, fmt.Errorf("route %d in %s has no queue", i+1, file)
+		}
+		if r.Name == "" {
+			table.Routes[i].Name = r.Queue
+		}
+	}
+	return table, nil
+}
+
+// resolve looks up the url of every target queue before anything is received
+func (table *routeTable) resolve(ctx context.Context, svc *sqs.SQS) error {
+	for i := range table.Routes {
+		url, err := resolveRouteQueue(ctx, svc, table.Routes[i].Queue)
+		if err != nil {
+			return err
+		}
+		table.Routes[i].url = url
+	}
+	if table.Default != "" {
+		url, err := resolveRouteQueue(ctx, svc, table.Default)
+		if err != nil {
+			return err
+		}
+		table.Default = url
+	}
+	return nil
+}
+
+// checkSource refuses a route back to the source queue, its messages would be received and routed forever
+func (table routeTable) checkSource(sourceURL string) error {
+	for _, r := range table.Routes {
+		if r.url == sourceURL {
+			return fmt.Errorf("route %s sends to the source queue %s", r.Name, sourceURL)
+		}
+	}
+	if table.Default == sourceURL {
+		return fmt.Errorf("the default route sends to the source queue %s", sourceURL)
+	}
+	return nil
+}
+
+func resolveRouteQueue(ctx context.Context, svc *sqs.SQS, queue string) (string, error) {
+	ref, err := queueRefOf(queue, "")
+	if err != nil {
+		return "", err
+	}
+	return ref.resolve(ctx, svc)
+}
+
+// routeFor returns the route name and queue url, the url is empty when the message stays in place
+func (table routeTable) routeFor(m message) (string, string) {
+	for _, r := range table.Routes {
+		if r.matches(m) {
+			return r.Name, r.url
+		}
+	}
+	if table.Default != "" {
+		return "default", table.Default
+	}
+	return RouteLeftInPlace, ""
+}
+
+func (r route) matches(m message) bool {
+	for k, pattern := range r.Match.Attributes {
+		if v, ok := m.CustAttrib[k]; !ok || !matchValue(pattern, v) {
+			return false
+		}
+	}
+	for k, pattern := range r.Match.Aws {
+		if v, ok := m.AwsAttrib[k]; !ok || !matchValue(pattern, v) {
+			return false
+		}
+	}
+	if len(r.Match.Body) == 0 {
+		return true
+	}
+	doc, err := decodeJsonBody(m.Message.String())
+	if err != nil {
+		return false
+	}
+	for p, pattern := range r.Match.Body {
+		v, ok := getPath(doc, splitPath(p))
+		if !ok || !matchValue(pattern, fmt.Sprint(v)) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchValue(pattern, value string) bool {
+	ok, err := path.Match(pattern, value)
+	return err == nil && ok || pattern == value
+}
+
+// routeMessages sends each message to its route and only then deletes it from the source
+func routeMessages(options routeOptions) error {
+	if err := options.table.resolve(options.ctx, options.svc); err != nil {
+		return err
+	}
+	if err := options.table.checkSource(options.queueURL); err != nil {
+		return err
+	}
+	held := newVisibilityManager(options.svc, options.queueURL, options.visibilityTimeout)
+	stop := held.start(options.ctx)
+	defer stop()
+	read := readQueueOptions{
+		svc:               options.svc,
+		queueURL:          options.queueURL,
+		visibilityTimeout: options.visibilityTimeout,
+		visibility:        held,
+		location:          options.location,
+		msg:               make(chan []message),
+		err:               make(chan error),
+		ctx:               options.ctx,
+		wg:                &sync.WaitGroup{},
+	}
+	for i := 0; i < 10; i++ {
+		read.wg.Add(1)
+		go readQueueData(read)
+	}
+	done := signalWaitGroupDone(read.wg)
+
+	counts := routeCounts{routed: make(map[string]int), failed: make(map[string]int)}
+	for {
+		select {
+		case <-done:
+			// with --dry-run every message is still held, and is released together by stop so none is received twice
+			stop()
+			counts.write(os.Stdout, options.dryRun)
+			if failed := counts.failedTotal(); failed > 0 {
+				return fmt.Errorf("%d messages failed", failed)
+			}
+			return nil
+		case err := <-read.err:
+			_, _ = fmt.Fprintf(os.Stderr, "Error:%v\n", err)
+		case batch := <-read.msg:
+			for _, m := range batch {
+				name, url := options.table.routeFor(m)
+				if options.dryRun {
+					counts.routed[name]++
+					continue
+				}
+				// anything not routed stays held and is released when the run ends, so it is not received and counted again
+				if url == "" {
+					counts.routed[name]++
+					continue
+				}
+				if err := routeOne(options, url, m); err != nil {
+					counts.failed[name]++
+					_, _ = fmt.Fprintf(os.Stderr, "Error Routing %s to %s: %v\n", m.MessageId, name, err)
+					continue
+				}
+				held.forget(m)
+				counts.routed[name]++
+			}
+		}
+	}
+}
+
+func routeOne(options routeOptions, url string, m message) error {
+	if _, err := options.svc.SendMessageWithContext(options.ctx, moveInput(url, m)); err != nil {
+		return err
+	}
+	// not cancelled by Ctrl-C, once sent it must be deleted or it would be in both queues
+	_, err := options.svc.DeleteMessageWithContext(context.Background(), &sqs.DeleteMessageInput{
+		QueueUrl:      aws.String(options.queueURL),
+		ReceiptHandle: m.Raw.ReceiptHandle,
+	})
+	if err != nil {
+		return fmt.Errorf("sent but not deleted, it will be routed again: %v", err)
+	}
+	return nil
+}
+
+func (c routeCounts) failedTotal() int {
+	var n int
+	for _, v := range c.failed {
+		n += v
+	}
+	return n
+}
+
+func (c routeCounts) write(w io.Writer, dryRun bool) {
+	var names []string
+	for name := range c.routed {
+		names = append(names, name)
+	}
+	for name := range c.failed {
+		if _, ok := c.routed[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		line := fmt.Sprintf("%5d %s", c.routed[name], name)
+		if c.failed[name] > 0 {
+			line += fmt.Sprintf(", %d failed", c.failed[name])
+		}
+		_, _ = fmt.Fprintln(w, line)
+	}
+	if dryRun {
+		_, _ = fmt.Fprintln(w, "dry run, nothing was sent")
+	}
+}
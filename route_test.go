@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_loading_routes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "routes")
+	require.NoError(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+	load := func(content string) (routeTable, error) {
+		file := filepath.Join(dir, "routes.yaml")
+		require.NoError(t, ioutil.WriteFile(file, []byte(content), 0666))
+		return loadRoutes(file)
+	}
+
+	table, err := load(`
+routes:
+  - queue: payments-dlq
+    match: {attributes: {service: payments}}
+  - name: poison
+    queue: https://sqs.eu-west-1.amazonaws.com/123456789012/poison
+    match: {aws: {ApproximateReceiveCount: "1?"}}
+default: misc-dlq
+`)
+	require.NoError(t, err)
+	require.Len(t, table.Routes, 2)
+	assert.Equal(t, "payments-dlq", table.Routes[0].Name, "the name defaults to the queue")
+	assert.Equal(t, "poison", table.Routes[1].Name)
+	assert.Equal(t, "misc-dlq", table.Default)
+
+	for name, content := range map[string]string{
+		"no routes":    "default: misc-dlq\n",
+		"no queue":     "routes: [{name: x}]\n",
+		"unknown keys": "routes: [{queue: x, when: {}}]\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := load(content)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func Test_choosing_a_route(t *testing.T) {
+	payments := route{Name: "payments", url: "payments-url"}
+	payments.Match.Attributes = map[string]string{"service": "pay*"}
+	refunds := route{Name: "refunds", url: "refunds-url"}
+	refunds.Match.Body = map[string]string{"$.type": "refund", "amount.currency": "EUR"}
+	poison := route{Name: "poison", url: "poison-url"}
+	poison.Match.Aws = map[string]string{"ApproximateReceiveCount": "1?"}
+	table := routeTable{Routes: []route{payments, refunds, poison}}
+
+	msg := func(attrs, aws map[string]string, body string) message {
+		return message{CustAttrib: attrs, AwsAttrib: aws, Message: flexiString(body)}
+	}
+	cases := []struct {
+		name  string
+		m     message
+		route string
+		url   string
+	}{
+		{"custom attribute wildcard", msg(map[string]string{"service": "payments"}, nil, "x"), "payments", "payments-url"},
+		{"body fields", msg(nil, nil, `{"type":"refund","amount":{"currency":"EUR"}}`), "refunds", "refunds-url"},
+		{"every body field must match", msg(nil, nil, `{"type":"refund","amount":{"currency":"GBP"}}`), RouteLeftInPlace, ""},
+		{"aws attribute", msg(nil, map[string]string{"ApproximateReceiveCount": "12"}, "x"), "poison", "poison-url"},
+		{"first match wins", msg(map[string]string{"service": "payments"}, map[string]string{"ApproximateReceiveCount": "12"}, "x"), "payments", "payments-url"},
+		{"body that is not json", msg(nil, nil, "type=refund"), RouteLeftInPlace, ""},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			name, url := table.routeFor(c.m)
+			assert.Equal(t, c.route, name)
+			assert.Equal(t, c.url, url)
+		})
+	}
+	t.Run("default", func(t *testing.T) {
+		table := table
+		table.Default = "misc-url"
+		name, url := table.routeFor(msg(nil, nil, "x"))
+		assert.Equal(t, "default", name)
+		assert.Equal(t, "misc-url", url)
+	})
+	t.Run("a route back to the source is refused", func(t *testing.T) {
+		assert.NoError(t, table.checkSource("source-url"))
+		assert.Error(t, table.checkSource("refunds-url"))
+
+		table := table
+		table.Default = "source-url"
+		assert.Error(t, table.checkSource("source-url"))
+	})
+}
+
+func Test_route_counts(t *testing.T) {
+	counts := routeCounts{
+		routed: map[string]int{"payments": 3, RouteLeftInPlace: 1},
+		failed: map[string]int{"payments": 1, "refunds": 2},
+	}
+	var buf bytes.Buffer
+	counts.write(&buf, false)
+	assert.Equal(t, ""+
+		"    1 (left in place)\n"+
+		"    3 payments, 1 failed\n"+
+		"    0 refunds, 2 failed\n", buf.String())
+	assert.Equal(t, 3, counts.failedTotal())
+}
@@ -2,52 +2,224 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
+	"github.com/NearlyUnique/awsqueue/queue"
 	"github.com/aws/aws-sdk-go/service/sqs"
 )
 
 type (
 	sendOptions struct {
-		svc      *sqs.SQS
-		queueURL string
-		err      chan error
-		ctx      context.Context
+		svc         *sqs.SQS
+		queueURL    string
+		source      string
+		rate        float64
+		burst       int
+		concurrency int
+		transform   messageTransform
+		dryRun      bool
+		preview     int
+		ctx         context.Context
+	}
+	// rateLimiter is a token bucket, a zero rate never waits
+	rateLimiter struct {
+		mu     sync.Mutex
+		rate   float64
+		burst  float64
+		tokens float64
+		last   time.Time
+	}
+	sendProgress struct {
+		total   int
+		sent    int64
+		failed  int64
+		started time.Time
 	}
 )
 
-func sendMessages(options sendOptions) {
-	finite := []string{"finite_1", "finite_2", "finite_3"}
-	//idPrefix := strconv.Itoa(int(time.Now().Unix()))
-	for i := 0; i < 100; i++ {
-		body := fmt.Sprintf("some content %02d", i)
-		id := fmt.Sprintf("unique_%02d", i)
-		attribs := map[string]*sqs.MessageAttributeValue{
-			"literal": msgAttrVal("literal_value"),
-			"finite":  msgAttrVal(finite[i%len(finite)]),
-			"unique":  msgAttrVal(id),
+func sendMessages(options sendOptions) error {
+	messages, err := loadSendSource(options.source)
+	if err != nil {
+		return err
+	}
+	if options.dryRun {
+		var ids []string
+		var inputs []*sqs.SendMessageInput
+		for i := 0; i < len(messages) && i < options.preview; i++ {
+			ids = append(ids, messages[i].MessageId)
+			inputs = append(inputs, queue.SendInput(options.queueURL, messages[i]))
+		}
+		previewTransform(options.ctx, os.Stdout, options.transform, ids, inputs)
+		return nil
+	}
+	concurrency := options.concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	limiter := newRateLimiter(options.rate, options.burst)
+	progress := &sendProgress{total: len(messages), started: time.Now()}
+
+	jobs := make(chan message)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for m := range jobs {
+				if limiter.wait(options.ctx) != nil {
+					return
+				}
+				input := queue.SendInput(options.queueURL, m)
+				if options.transform != nil {
+					if err := options.transform(options.ctx, input); err != nil {
+						atomic.AddInt64(&progress.failed, 1)
+						_, _ = fmt.Fprintf(os.Stderr, "\nError Transforming: %v\n", err)
+						continue
+					}
+				}
+				if _, err := options.svc.SendMessageWithContext(options.ctx, input); err != nil {
+					atomic.AddInt64(&progress.failed, 1)
+					if options.ctx.Err() == nil {
+						_, _ = fmt.Fprintf(os.Stderr, "\nError Sending: %v\n", err)
+					}
+					continue
+				}
+				atomic.AddInt64(&progress.sent, 1)
+			}
+		}()
+	}
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	done := signalWaitGroupDone(&wg)
+	go func() {
+		defer close(jobs)
+		for _, m := range messages {
+			select {
+			case <-options.ctx.Done():
+				return
+			case jobs <- m:
+			}
+		}
+	}()
+	for {
+		select {
+		case <-ticker.C:
+			progress.print()
+		case <-done:
+			progress.print()
+			_, _ = fmt.Fprintln(os.Stderr)
+			if options.ctx.Err() != nil {
+				return fmt.Errorf("stopped, sent %d of %d messages", progress.sent, progress.total)
+			}
+			if progress.failed > 0 {
+				return fmt.Errorf("sent %d of %d messages, %d failed", progress.sent, progress.total, progress.failed)
+			}
+			return nil
+		}
+	}
+}
+
+// loadSendSource reads messages in the format written by --read
+func loadSendSource(source string) ([]message, error) {
+	buf, err := ioutil.ReadFile(source)
+	if err != nil {
+		return nil, err
+	}
+	var result readQueueResult
+	if err := json.Unmarshal(buf, &result); err != nil {
+		return nil, fmt.Errorf("failed reading %s: %v", source, err)
+	}
+	for _, m := range result.Messages {
+		// older files only kept the decoded body, sending it would not be the message that was read
+		if len(m.Decoded) > 0 && m.Body == "" {
+			return nil, fmt.Errorf("%s: message %s was decoded (%s) and the original body was not kept, read the queue again", source, m.MessageId, strings.Join(m.Decoded, ", "))
+		}
+	}
+	return result.Messages, nil
+}
+
+// parseRate accepts N, N/s or N/m and returns messages per second
+func parseRate(value string) (float64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	per := time.Second
+	if i := strings.Index(value, "/"); i >= 0 {
+		switch value[i+1:] {
+		case "s":
+		case "m":
+			per = time.Minute
+		default:
+			return 0, fmt.Errorf("invalid --rate %q, use N/s or N/m", value)
 		}
-		target := sqs.SendMessageInput{
-			MessageAttributes: attribs,
-			MessageBody:       &body,
-			// this is only valid for FIFO queues
-			//MessageDeduplicationId: aws.String(idPrefix + id),
-			QueueUrl: &options.queueURL,
+		value = value[:i]
+	}
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid --rate %q, use N/s or N/m", value)
+	}
+	return n / per.Seconds(), nil
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimiter{rate: rate, burst: float64(burst), tokens: float64(burst)}
+}
+
+func (r *rateLimiter) wait(ctx context.Context) error {
+	for {
+		delay := r.reserve(time.Now())
+		if delay == 0 {
+			return nil
 		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
 
-		//_ = target
-		_, err := options.svc.SendMessageWithContext(options.ctx, &target)
-		if err != nil {
-			_, _ = fmt.Fprintf(os.Stderr, "Error Sending: %v\n", err)
-			//options.err <- err
+// reserve takes a token if one is available, otherwise returns how long until there will be
+func (r *rateLimiter) reserve(now time.Time) time.Duration {
+	if r.rate <= 0 {
+		return 0
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.last.IsZero() {
+		r.tokens += now.Sub(r.last).Seconds() * r.rate
+		if r.tokens > r.burst {
+			r.tokens = r.burst
 		}
 	}
+	r.last = now
+	if r.tokens >= 1 {
+		r.tokens--
+		return 0
+	}
+	return time.Duration((1 - r.tokens) / r.rate * float64(time.Second))
 }
-func msgAttrVal(value string) *sqs.MessageAttributeValue {
-	return &sqs.MessageAttributeValue{
-		DataType:    aws.String("String"),
-		StringValue: aws.String(value),
+
+func (p *sendProgress) print() {
+	sent := atomic.LoadInt64(&p.sent)
+	elapsed := time.Since(p.started)
+	rate := float64(sent) / elapsed.Seconds()
+	eta := "-"
+	if rate > 0 {
+		remaining := float64(int64(p.total)-sent-atomic.LoadInt64(&p.failed)) / rate
+		eta = time.Duration(remaining * float64(time.Second)).Round(time.Second).String()
 	}
+	_, _ = fmt.Fprintf(os.Stderr, "\rsent %d/%d %.1f msg/s eta %s   ", sent, p.total, rate, eta)
 }
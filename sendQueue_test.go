@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/NearlyUnique/awsqueue/queue"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_send_rate_is_parsed(t *testing.T) {
+	tests := map[string]float64{
+		"":     0,
+		"10":   10,
+		"10/s": 10,
+		"60/m": 1,
+	}
+	for value, expected := range tests {
+		rate, err := parseRate(value)
+
+		require.NoError(t, err, value)
+		assert.Equal(t, expected, rate, value)
+	}
+	for _, value := range []string{"ten", "10/h", "-1/s"} {
+		_, err := parseRate(value)
+
+		assert.Error(t, err, value)
+	}
+}
+
+func Test_rate_limiter(t *testing.T) {
+	t.Run("a zero rate never waits", func(t *testing.T) {
+		r := newRateLimiter(0, 1)
+		now := time.Now()
+
+		for i := 0; i < 100; i++ {
+			assert.Equal(t, time.Duration(0), r.reserve(now))
+		}
+	})
+	t.Run("the burst is available immediately then sends are spaced by the rate", func(t *testing.T) {
+		r := newRateLimiter(10, 3)
+		now := time.Now()
+
+		assert.Equal(t, time.Duration(0), r.reserve(now))
+		assert.Equal(t, time.Duration(0), r.reserve(now))
+		assert.Equal(t, time.Duration(0), r.reserve(now))
+		assert.Equal(t, 100*time.Millisecond, r.reserve(now))
+
+		assert.Equal(t, time.Duration(0), r.reserve(now.Add(100*time.Millisecond)))
+	})
+	t.Run("idle time does not build up more than the burst", func(t *testing.T) {
+		r := newRateLimiter(10, 2)
+		now := time.Now()
+		r.reserve(now)
+
+		later := now.Add(time.Hour)
+		assert.Equal(t, time.Duration(0), r.reserve(later))
+		assert.Equal(t, time.Duration(0), r.reserve(later))
+		assert.NotEqual(t, time.Duration(0), r.reserve(later))
+	})
+}
+
+func Test_a_read_result_can_be_used_as_a_send_source(t *testing.T) {
+	original := readQueueResult{
+		Messages: []message{
+			{Message: `{"some":true}`, ContentType: queue.ContentTypeJSON, CustAttrib: map[string]string{"k": "v"}},
+			{Message: `"quoted"`, ContentType: queue.ContentTypeJSON},
+			{Message: `{"some":}`, ContentType: queue.ContentTypeText},
+		},
+	}
+	buf, err := jsonMarshal(original)
+	require.NoError(t, err)
+
+	var actual readQueueResult
+	require.NoError(t, json.Unmarshal(buf, &actual))
+
+	require.Len(t, actual.Messages, 3)
+	assert.Equal(t, flexiString(`{"some":true}`), actual.Messages[0].Message)
+	assert.Equal(t, "v", actual.Messages[0].CustAttrib["k"])
+	assert.Equal(t, flexiString(`"quoted"`), actual.Messages[1].Message)
+	assert.Equal(t, flexiString(`{"some":}`), actual.Messages[2].Message)
+
+	input := queue.SendInput("http://any.com/1", actual.Messages[0])
+	assert.Equal(t, `{"some":true}`, *input.MessageBody)
+	assert.Equal(t, "v", *input.MessageAttributes["k"].StringValue)
+}
+
+func Test_a_send_source_without_original_bodies_is_refused(t *testing.T) {
+	f, err := ioutil.TempFile("", "awsqueue")
+	require.NoError(t, err)
+	defer func() { _ = os.Remove(f.Name()) }()
+	_, err = f.WriteString(`{"messages":[{"messageId":"id-1","message":"decoded","decoded":["base64"]}]}`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	_, err = loadSendSource(f.Name())
+
+	assert.Error(t, err)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+)
+
+type tagOptions struct {
+	svc         sqsiface.SQSAPI
+	queueURL    string
+	tag         map[string]string
+	untag       []string
+	dryRun      bool
+	interaction interactionType
+	yes         bool
+	ctx         context.Context
+}
+
+func formatTags(tags map[string]string) string {
+	if len(tags) == 0 {
+		return ""
+	}
+	var pairs []string
+	for k, v := range tags {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return " [" + strings.Join(pairs, ",") + "]"
+}
+
+func tagQueue(options tagOptions) error {
+	if len(options.tag) == 0 && len(options.untag) == 0 {
+		return errors.New("no tags to change")
+	}
+	if len(options.tag) > 0 {
+		fmt.Printf("tag%s\n", formatTags(options.tag))
+	}
+	if len(options.untag) > 0 {
+		fmt.Printf("untag [%s]\n", strings.Join(options.untag, ","))
+	}
+	if options.dryRun {
+		return nil
+	}
+	ok, err := confirm("Change the tags of the queue?", options.interaction, options.yes)
+	if err != nil || !ok {
+		return err
+	}
+	if len(options.tag) > 0 {
+		tags := make(map[string]*string)
+		for k, v := range options.tag {
+			tags[k] = aws.String(v)
+		}
+		_, err := options.svc.TagQueueWithContext(options.ctx, &sqs.TagQueueInput{QueueUrl: &options.queueURL, Tags: tags})
+		if err != nil {
+			return err
+		}
+	}
+	if len(options.untag) > 0 {
+		_, err := options.svc.UntagQueueWithContext(options.ctx, &sqs.UntagQueueInput{
+			QueueUrl: &options.queueURL,
+			TagKeys:  aws.StringSlice(options.untag),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/NearlyUnique/awsqueue/queue"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_tags_are_shown_after_the_queue_name(t *testing.T) {
+	attrs := map[string]flexiString{queue.AttrKeyQueueTags: queue.TagsAttr(map[string]*string{"team": aws.String("payments"), "service": aws.String("api")})}
+
+	assert.Equal(t, " [service=api,team=payments]", formatTags(queue.TagsOf(attrs)))
+	assert.Equal(t, "", formatTags(nil))
+}
+
+func Test_changing_queue_tags(t *testing.T) {
+	change := func(fake *fakeQueueAdmin, dryRun, yes bool) error {
+		return tagQueue(tagOptions{
+			svc:         fake,
+			queueURL:    "http://any.com/1/orders",
+			tag:         map[string]string{"team": "payments"},
+			untag:       []string{"owner"},
+			dryRun:      dryRun,
+			interaction: noInteraction,
+			yes:         yes,
+			ctx:         context.Background(),
+		})
+	}
+	t.Run("a dry run makes no calls", func(t *testing.T) {
+		fake := &fakeQueueAdmin{}
+
+		require.NoError(t, change(fake, true, false))
+		assert.Empty(t, fake.tagged)
+		assert.Empty(t, fake.untagged)
+	})
+	t.Run("without --yes it is refused", func(t *testing.T) {
+		fake := &fakeQueueAdmin{}
+
+		err := change(fake, false, false)
+
+		assert.EqualError(t, err, "Change the tags of the queue needs --yes with --no-interaction")
+		assert.Empty(t, fake.tagged)
+		assert.Empty(t, fake.untagged)
+	})
+	t.Run("with --yes the queue is tagged and untagged", func(t *testing.T) {
+		fake := &fakeQueueAdmin{}
+
+		require.NoError(t, change(fake, false, true))
+		assert.Equal(t, map[string]map[string]string{"http://any.com/1/orders": {"team": "payments"}}, fake.tagged)
+		assert.Equal(t, map[string][]string{"http://any.com/1/orders": {"owner"}}, fake.untagged)
+	})
+}
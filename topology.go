@@ -0,0 +1,238 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/NearlyUnique/awsqueue/queue"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+const (
+	AttrKeyRedriveAllowPolicy = "RedriveAllowPolicy"
+
+	TopologyText = "text"
+	TopologyJSON = "json"
+	TopologyDot  = "dot"
+)
+
+type (
+	topologyQueue struct {
+		Name     string `json:"name"`
+		Messages string `json:"messages"`
+	}
+	topologyRedrive struct {
+		Source          topologyQueue `json:"source"`
+		DeadLetter      topologyQueue `json:"deadLetter"`
+		MaxReceiveCount int64         `json:"maxReceiveCount"`
+		// Error is why the RedrivePolicy could not be read, the dead letter queue may be unknown
+		Error string `json:"error,omitempty"`
+	}
+	queueTopology struct {
+		Redrives []topologyRedrive `json:"redrives"`
+		// UnusedDeadLetter are dead letter queues that no listed queue redrives to
+		UnusedDeadLetter []topologyQueue `json:"unusedDeadLetterQueues"`
+		// NoDeadLetter are source queues without a redrive policy
+		NoDeadLetter []topologyQueue `json:"queuesWithoutDeadLetterQueue"`
+	}
+)
+
+// listTopology lists every queue, so redrives from queues that --filter or --tag leave out are still known,
+// the result keeps them to choose what is shown
+func listTopology(options listQueueOptions) (QueueSearchResult, error) {
+	all := options
+	all.filter = ""
+	all.tags = nil
+	result, err := listQueues(all)
+	result.Filter = options.filter
+	result.Tags = options.tags
+	return result, err
+}
+
+// buildTopology shows the queues matching the result's filter and tags, and every redrive to or from them
+func buildTopology(result QueueSearchResult) queueTopology {
+	shown := func(attr map[string]flexiString) bool {
+		return result.MatchesFilter(attr[queue.AttrKeyQueueUrl].String()) && result.MatchesTags(attr)
+	}
+	byArn := make(map[string]map[string]flexiString)
+	for _, attr := range result.Attrs {
+		byArn[attr[sqs.QueueAttributeNameQueueArn].String()] = attr
+	}
+	var topology queueTopology
+	targeted := make(map[string]bool)
+	for _, attr := range result.Attrs {
+		policy := attr[sqs.QueueAttributeNameRedrivePolicy]
+		if policy == "" {
+			continue
+		}
+		redrive, err := parseRedrivePolicy(policy.String())
+		targeted[redrive.DeadLetterTargetArn] = true
+		dlq := topologyQueue{Name: arnName(redrive.DeadLetterTargetArn), Messages: "?"}
+		target, ok := byArn[redrive.DeadLetterTargetArn]
+		if ok {
+			dlq = topologyNode(target)
+		}
+		if !shown(attr) && !(ok && shown(target)) {
+			continue
+		}
+		edge := topologyRedrive{
+			Source:          topologyNode(attr),
+			DeadLetter:      dlq,
+			MaxReceiveCount: redrive.MaxReceiveCount,
+		}
+		if err != nil {
+			edge.Error = fmt.Sprintf("invalid RedrivePolicy: %v", err)
+		}
+		topology.Redrives = append(topology.Redrives, edge)
+	}
+	for _, attr := range result.Attrs {
+		if attr[sqs.QueueAttributeNameRedrivePolicy] != "" || targeted[attr[sqs.QueueAttributeNameQueueArn].String()] || !shown(attr) {
+			continue
+		}
+		if looksLikeDeadLetter(attr) {
+			topology.UnusedDeadLetter = append(topology.UnusedDeadLetter, topologyNode(attr))
+		} else {
+			topology.NoDeadLetter = append(topology.NoDeadLetter, topologyNode(attr))
+		}
+	}
+	sort.Slice(topology.Redrives, func(i, j int) bool {
+		return topology.Redrives[i].Source.Name < topology.Redrives[j].Source.Name
+	})
+	sortTopologyQueues(topology.UnusedDeadLetter)
+	sortTopologyQueues(topology.NoDeadLetter)
+	return topology
+}
+
+// looksLikeDeadLetter guesses at queues nothing redrives to, either by an explicit allow policy or the name
+func looksLikeDeadLetter(attr map[string]flexiString) bool {
+	if policy := attr[AttrKeyRedriveAllowPolicy].String(); policy != "" && !strings.Contains(policy, "denyAll") {
+		return true
+	}
+	name := strings.ToLower(attr[queue.AttrKeyQueueName].String())
+	name = strings.TrimSuffix(name, ".fifo")
+	return strings.HasSuffix(name, "dlq") || strings.Contains(name, "dead-letter") || strings.Contains(name, "deadletter")
+}
+
+// parseRedrivePolicy accepts maxReceiveCount as a number or a string, as SQS does,
+// the dead letter queue ARN is returned when only the count is invalid
+func parseRedrivePolicy(policy string) (redrivePolicy, error) {
+	var raw struct {
+		DeadLetterTargetArn string      `json:"deadLetterTargetArn"`
+		MaxReceiveCount     interface{} `json:"maxReceiveCount"`
+	}
+	if err := json.Unmarshal([]byte(policy), &raw); err != nil {
+		return redrivePolicy{}, err
+	}
+	redrive := redrivePolicy{DeadLetterTargetArn: raw.DeadLetterTargetArn}
+	if raw.DeadLetterTargetArn == "" {
+		return redrive, errors.New("no deadLetterTargetArn")
+	}
+	switch count := raw.MaxReceiveCount.(type) {
+	case float64:
+		redrive.MaxReceiveCount = int64(count)
+	case string:
+		n, err := strconv.ParseInt(count, 10, 64)
+		if err != nil {
+			return redrive, fmt.Errorf("maxReceiveCount %q is not a number", count)
+		}
+		redrive.MaxReceiveCount = n
+	default:
+		return redrive, fmt.Errorf("maxReceiveCount %v is not a number", raw.MaxReceiveCount)
+	}
+	return redrive, nil
+}
+
+func topologyNode(attr map[string]flexiString) topologyQueue {
+	return topologyQueue{
+		Name:     attr[queue.AttrKeyQueueName].String(),
+		Messages: attr[sqs.QueueAttributeNameApproximateNumberOfMessages].String(),
+	}
+}
+
+func sortTopologyQueues(queues []topologyQueue) {
+	sort.Slice(queues, func(i, j int) bool { return queues[i].Name < queues[j].Name })
+}
+
+func arnName(arn string) string {
+	if arn == "" {
+		return "?"
+	}
+	parts := strings.Split(arn, ":")
+	return parts[len(parts)-1]
+}
+
+func printTopology(w io.Writer, format string, topology queueTopology) error {
+	switch format {
+	case TopologyJSON:
+		buf, err := jsonMarshal(topology)
+		if err != nil {
+			return fmt.Errorf("failed marshalling json: %v", err)
+		}
+		_, err = fmt.Fprintln(w, string(buf))
+		return err
+	case TopologyDot:
+		writeTopologyDot(w, topology)
+		return nil
+	case TopologyText, "":
+		writeTopologyText(w, topology)
+		return nil
+	}
+	return fmt.Errorf("unknown topology format %q, use %s, %s or %s", format, TopologyText, TopologyJSON, TopologyDot)
+}
+
+func writeTopologyText(w io.Writer, topology queueTopology) {
+	for _, r := range topology.Redrives {
+		_, _ = fmt.Fprintf(w, "%5s %s\n", r.Source.Messages, r.Source.Name)
+		if r.Error != "" {
+			_, _ = fmt.Fprintf(w, "%5s └─ %s (%s)\n", r.DeadLetter.Messages, r.DeadLetter.Name, r.Error)
+			continue
+		}
+		_, _ = fmt.Fprintf(w, "%5s └─ %s (maxReceiveCount %d)\n", r.DeadLetter.Messages, r.DeadLetter.Name, r.MaxReceiveCount)
+	}
+	if len(topology.NoDeadLetter) > 0 {
+		_, _ = fmt.Fprintln(w, "no dead letter queue:")
+		for _, q := range topology.NoDeadLetter {
+			_, _ = fmt.Fprintf(w, "%5s %s\n", q.Messages, q.Name)
+		}
+	}
+	if len(topology.UnusedDeadLetter) > 0 {
+		_, _ = fmt.Fprintln(w, "dead letter queues with no source:")
+		for _, q := range topology.UnusedDeadLetter {
+			_, _ = fmt.Fprintf(w, "%5s %s\n", q.Messages, q.Name)
+		}
+	}
+}
+
+func writeTopologyDot(w io.Writer, topology queueTopology) {
+	node := func(q topologyQueue, style string) {
+		_, _ = fmt.Fprintf(w, "  %q [label=%q%s];\n", q.Name, q.Name+"\n"+q.Messages, style)
+	}
+	_, _ = fmt.Fprintln(w, "digraph redrive {")
+	_, _ = fmt.Fprintln(w, "  rankdir=LR;")
+	seen := make(map[string]bool)
+	for _, r := range topology.Redrives {
+		for _, q := range []topologyQueue{r.Source, r.DeadLetter} {
+			if !seen[q.Name] {
+				seen[q.Name] = true
+				node(q, "")
+			}
+		}
+		if r.Error != "" {
+			_, _ = fmt.Fprintf(w, "  %q -> %q [label=%q, color=red];\n", r.Source.Name, r.DeadLetter.Name, r.Error)
+			continue
+		}
+		_, _ = fmt.Fprintf(w, "  %q -> %q [label=\"%d\"];\n", r.Source.Name, r.DeadLetter.Name, r.MaxReceiveCount)
+	}
+	for _, q := range topology.NoDeadLetter {
+		node(q, ", color=red")
+	}
+	for _, q := range topology.UnusedDeadLetter {
+		node(q, ", style=dashed")
+	}
+	_, _ = fmt.Fprintln(w, "}")
+}
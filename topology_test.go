@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/NearlyUnique/awsqueue/queue"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_redrive_topology(t *testing.T) {
+	queueAttrs := func(name, count, redrive string) map[string]flexiString {
+		return map[string]flexiString{
+			queue.AttrKeyQueueName:                            flexiString(name),
+			queue.AttrKeyQueueUrl:                             flexiString("https://sqs.eu-west-1.amazonaws.com/1/" + name),
+			sqs.QueueAttributeNameQueueArn:                    flexiString("arn:aws:sqs:eu-west-1:1:" + name),
+			sqs.QueueAttributeNameApproximateNumberOfMessages: flexiString(count),
+			sqs.QueueAttributeNameRedrivePolicy:               flexiString(redrive),
+		}
+	}
+	result := QueueSearchResult{
+		Attrs: []map[string]flexiString{
+			queueAttrs("orders-dlq", "7", ""),
+			queueAttrs("orders", "1", `{"deadLetterTargetArn":"arn:aws:sqs:eu-west-1:1:orders-dlq","maxReceiveCount":5}`),
+			queueAttrs("payments", "0", ""),
+			queueAttrs("old-dlq", "2", ""),
+			queueAttrs("refunds", "0", `{"deadLetterTargetArn":"arn:aws:sqs:eu-west-1:1:elsewhere-dlq","maxReceiveCount":3}`),
+		},
+	}
+
+	topology := buildTopology(result)
+
+	require.Len(t, topology.Redrives, 2)
+	assert.Equal(t, topologyQueue{Name: "orders", Messages: "1"}, topology.Redrives[0].Source)
+	assert.Equal(t, topologyQueue{Name: "orders-dlq", Messages: "7"}, topology.Redrives[0].DeadLetter)
+	assert.Equal(t, int64(5), topology.Redrives[0].MaxReceiveCount)
+	assert.Equal(t, topologyQueue{Name: "elsewhere-dlq", Messages: "?"}, topology.Redrives[1].DeadLetter)
+	assert.Equal(t, []topologyQueue{{Name: "payments", Messages: "0"}}, topology.NoDeadLetter)
+	assert.Equal(t, []topologyQueue{{Name: "old-dlq", Messages: "2"}}, topology.UnusedDeadLetter)
+
+	t.Run("dot output links sources to dead letter queues", func(t *testing.T) {
+		var buf bytes.Buffer
+
+		require.NoError(t, printTopology(&buf, TopologyDot, topology))
+
+		assert.Contains(t, buf.String(), `"orders" -> "orders-dlq" [label="5"];`)
+	})
+	t.Run("unknown formats are an error", func(t *testing.T) {
+		assert.Error(t, printTopology(&bytes.Buffer{}, "svg", topology))
+	})
+	t.Run("a filter keeps redrives from queues it leaves out", func(t *testing.T) {
+		filtered := result
+		filtered.Filter = "dlq"
+
+		topology := buildTopology(filtered)
+
+		require.Len(t, topology.Redrives, 1)
+		assert.Equal(t, "orders", topology.Redrives[0].Source.Name)
+		assert.Equal(t, []topologyQueue{{Name: "old-dlq", Messages: "2"}}, topology.UnusedDeadLetter)
+		assert.Empty(t, topology.NoDeadLetter)
+	})
+	t.Run("a policy that cannot be read is an edge with an error", func(t *testing.T) {
+		invalid := QueueSearchResult{Attrs: []map[string]flexiString{
+			queueAttrs("orders-dlq", "7", ""),
+			queueAttrs("orders", "1", `{"deadLetterTargetArn":"arn:aws:sqs:eu-west-1:1:orders-dlq","maxReceiveCount":"many"}`),
+			queueAttrs("refunds", "0", `{"deadLetterTargetArn":"arn:aws:sqs:eu-west-1:1:orders-dlq","maxReceiveCount":"3"}`),
+			queueAttrs("payments", "0", `not json`),
+		}}
+
+		topology := buildTopology(invalid)
+
+		require.Len(t, topology.Redrives, 3)
+		assert.Equal(t, "orders-dlq", topology.Redrives[0].DeadLetter.Name)
+		assert.Contains(t, topology.Redrives[0].Error, "maxReceiveCount")
+		assert.Equal(t, "?", topology.Redrives[1].DeadLetter.Name)
+		assert.NotEmpty(t, topology.Redrives[1].Error)
+		assert.Equal(t, int64(3), topology.Redrives[2].MaxReceiveCount)
+		assert.Empty(t, topology.Redrives[2].Error)
+		assert.Empty(t, topology.UnusedDeadLetter)
+	})
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/NearlyUnique/awsqueue/queue"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"gopkg.in/yaml.v2"
+)
+
+type (
+	// messageTransform rewrites a message just before it is sent
+	messageTransform func(ctx context.Context, input *sqs.SendMessageInput) error
+	transformOptions struct {
+		rulesFile string
+		template  string
+		command   string
+	}
+	// transformRules are applied rename, set then delete, body paths are dotted with an optional $. prefix
+	transformRules struct {
+		Attributes struct {
+			Rename map[string]string `yaml:"rename"`
+			Set    map[string]string `yaml:"set"`
+			Delete []string          `yaml:"delete"`
+		} `yaml:"attributes"`
+		Body struct {
+			Rename map[string]string      `yaml:"rename"`
+			Set    map[string]interface{} `yaml:"set"`
+			Delete []string               `yaml:"delete"`
+		} `yaml:"body"`
+	}
+	templateData struct {
+		Body       interface{}
+		Raw        string
+		Attributes map[string]string
+	}
+)
+
+// newTransform chains the rules, template and command in that order, it is nil when none are given
+func newTransform(options transformOptions) (messageTransform, error) {
+	var steps []messageTransform
+	if options.rulesFile != "" {
+		buf, err := ioutil.ReadFile(options.rulesFile)
+		if err != nil {
+			return nil, err
+		}
+		var rules transformRules
+		if err := yaml.UnmarshalStrict(buf, &rules); err != nil {
+			return nil, fmt.Errorf("failed reading %s: %v", options.rulesFile, err)
+		}
+		steps = append(steps, rules.apply)
+	}
+	if options.template != "" {
+		tmpl, err := template.New("transform").Funcs(template.FuncMap{"json": toJson}).Parse(options.template)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --template: %v", err)
+		}
+		steps = append(steps, templateTransform(tmpl))
+	}
+	if options.command != "" {
+		steps = append(steps, commandTransform(options.command))
+	}
+	if len(steps) == 0 {
+		return nil, nil
+	}
+	return func(ctx context.Context, input *sqs.SendMessageInput) error {
+		// the attributes may be shared with the received message
+		attrs := make(map[string]*sqs.MessageAttributeValue, len(input.MessageAttributes))
+		for k, v := range input.MessageAttributes {
+			attrs[k] = v
+		}
+		input.MessageAttributes = attrs
+		for _, step := range steps {
+			if err := step(ctx, input); err != nil {
+				return err
+			}
+		}
+		if len(input.MessageAttributes) == 0 {
+			input.MessageAttributes = nil
+		}
+		return nil
+	}, nil
+}
+
+func (rules transformRules) apply(_ context.Context, input *sqs.SendMessageInput) error {
+	attrs := input.MessageAttributes
+	for from, to := range rules.Attributes.Rename {
+		if v, ok := attrs[from]; ok {
+			delete(attrs, from)
+			attrs[to] = v
+		}
+	}
+	for k, v := range rules.Attributes.Set {
+		attrs[k] = queue.StringAttribute(v)
+	}
+	for _, k := range rules.Attributes.Delete {
+		delete(attrs, k)
+	}
+
+	body := rules.Body
+	if len(body.Rename) == 0 && len(body.Set) == 0 && len(body.Delete) == 0 {
+		return nil
+	}
+	doc, err := decodeJsonBody(aws.StringValue(input.MessageBody))
+	if err != nil {
+		return err
+	}
+	for from, to := range body.Rename {
+		if v, ok := getPath(doc, splitPath(from)); ok {
+			deletePath(doc, splitPath(from))
+			if doc, err = setPath(doc, splitPath(to), v); err != nil {
+				return err
+			}
+		}
+	}
+	for path, v := range body.Set {
+		if doc, err = setPath(doc, splitPath(path), fromYaml(v)); err != nil {
+			return err
+		}
+	}
+	for _, path := range body.Delete {
+		deletePath(doc, splitPath(path))
+	}
+	buf, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	input.MessageBody = aws.String(string(buf))
+	return nil
+}
+
+// templateTransform replaces the body with the template output, the body is parsed when it is json
+func templateTransform(tmpl *template.Template) messageTransform {
+	return func(_ context.Context, input *sqs.SendMessageInput) error {
+		raw := aws.StringValue(input.MessageBody)
+		data := templateData{Body: raw, Raw: raw, Attributes: attributeStrings(input.MessageAttributes)}
+		if doc, err := decodeJsonBody(raw); err == nil {
+			data.Body = doc
+		}
+		var out bytes.Buffer
+		if err := tmpl.Execute(&out, data); err != nil {
+			return err
+		}
+		input.MessageBody = aws.String(out.String())
+		return nil
+	}
+}
+
+// commandTransform pipes the body through a shell command, attributes are in AWSQUEUE_ATTR_<NAME>
+func commandTransform(command string) messageTransform {
+	return func(ctx context.Context, input *sqs.SendMessageInput) error {
+		cmd := exec.CommandContext(ctx, "sh", "-c", command)
+		cmd.Stdin = strings.NewReader(aws.StringValue(input.MessageBody))
+		cmd.Env = append(os.Environ(), envVars("AWSQUEUE_ATTR_", attributeStrings(input.MessageAttributes))...)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return fmt.Errorf("transform command failed: %v %s", err, strings.TrimSpace(stderr.String()))
+		}
+		input.MessageBody = aws.String(strings.TrimSuffix(string(out), "\n"))
+		return nil
+	}
+}
+
+func attributeStrings(attrs map[string]*sqs.MessageAttributeValue) map[string]string {
+	values := make(map[string]string, len(attrs))
+	for k, v := range attrs {
+		if v != nil {
+			values[k] = aws.StringValue(v.StringValue)
+		}
+	}
+	return values
+}
+
+// envVars names each value PREFIX<NAME>, upper case with anything not valid in a name as _
+func envVars(prefix string, values map[string]string) []string {
+	var env []string
+	for k, v := range values {
+		env = append(env, fmt.Sprintf("%s%s=%s", prefix, strings.ToUpper(labelName(k)), v))
+	}
+	sort.Strings(env)
+	return env
+}
+
+func decodeJsonBody(body string) (interface{}, error) {
+	dec := json.NewDecoder(strings.NewReader(body))
+	dec.UseNumber()
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return nil, errors.New("the body is not json, it cannot be transformed by path")
+	}
+	return doc, nil
+}
+
+func toJson(v interface{}) (string, error) {
+	buf, err := json.Marshal(v)
+	return string(buf), err
+}
+
+func splitPath(path string) []string {
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	return strings.Split(path, ".")
+}
+
+func getPath(doc interface{}, path []string) (interface{}, bool) {
+	for _, key := range path {
+		switch node := doc.(type) {
+		case map[string]interface{}:
+			v, ok := node[key]
+			if !ok {
+				return nil, false
+			}
+			doc = v
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, false
+			}
+			doc = node[i]
+		default:
+			return nil, false
+		}
+	}
+	return doc, true
+}
+
+// setPath creates any missing objects along the path, it returns the new root when the root is replaced
+func setPath(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 || path[0] == "" {
+		return value, nil
+	}
+	switch node := doc.(type) {
+	case map[string]interface{}:
+		child, err := setPath(node[path[0]], path[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		node[path[0]] = child
+		return node, nil
+	case []interface{}:
+		i, err := strconv.Atoi(path[0])
+		if err != nil || i < 0 || i >= len(node) {
+			return nil, fmt.Errorf("no element %s in array", path[0])
+		}
+		child, err := setPath(node[i], path[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		node[i] = child
+		return node, nil
+	case nil:
+		return setPath(map[string]interface{}{}, path, value)
+	default:
+		return nil, fmt.Errorf("cannot set %s on a %T", strings.Join(path, "."), doc)
+	}
+}
+
+func deletePath(doc interface{}, path []string) {
+	parent, ok := getPath(doc, path[:len(path)-1])
+	if !ok {
+		return
+	}
+	if node, ok := parent.(map[string]interface{}); ok {
+		delete(node, path[len(path)-1])
+	}
+}
+
+// fromYaml turns the maps yaml.v2 decodes into ones encoding/json can marshal
+func fromYaml(v interface{}) interface{} {
+	switch node := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(node))
+		for k, v := range node {
+			m[fmt.Sprint(k)] = fromYaml(v)
+		}
+		return m
+	case []interface{}:
+		for i := range node {
+			node[i] = fromYaml(node[i])
+		}
+		return node
+	}
+	return v
+}
+
+// previewTransform shows each input before and after the transform, nothing is sent
+func previewTransform(ctx context.Context, w io.Writer, transform messageTransform, ids []string, inputs []*sqs.SendMessageInput) {
+	for i, input := range inputs {
+		before := *input
+		after := *input
+		_, _ = fmt.Fprintf(w, "message %s\n", ids[i])
+		_, _ = fmt.Fprintf(w, "- %s\n- %s\n", aws.StringValue(before.MessageBody), formatAttributes(before.MessageAttributes))
+		if transform != nil {
+			if err := transform(ctx, &after); err != nil {
+				_, _ = fmt.Fprintf(w, "! %v\n", err)
+				continue
+			}
+		}
+		_, _ = fmt.Fprintf(w, "+ %s\n+ %s\n", aws.StringValue(after.MessageBody), formatAttributes(after.MessageAttributes))
+	}
+}
+
+func formatAttributes(attrs map[string]*sqs.MessageAttributeValue) string {
+	values := attributeStrings(attrs)
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var pairs []string
+	for _, k := range keys {
+		pairs = append(pairs, k+"="+values[k])
+	}
+	return "attributes: " + strings.Join(pairs, ", ")
+}
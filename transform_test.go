@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/NearlyUnique/awsqueue/queue"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func transformInput(body string, attrs map[string]string) *sqs.SendMessageInput {
+	input := &sqs.SendMessageInput{MessageBody: aws.String(body), MessageAttributes: map[string]*sqs.MessageAttributeValue{}}
+	for k, v := range attrs {
+		input.MessageAttributes[k] = queue.StringAttribute(v)
+	}
+	return input
+}
+
+func rulesTransform(t *testing.T, dir, rules string) (messageTransform, error) {
+	file := filepath.Join(dir, "rules.yaml")
+	require.NoError(t, ioutil.WriteFile(file, []byte(rules), 0666))
+	return newTransform(transformOptions{rulesFile: file})
+}
+
+func Test_transforming_with_rules(t *testing.T) {
+	dir, err := ioutil.TempDir("", "transform")
+	require.NoError(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+	transform, err := rulesTransform(t, dir, `
+attributes:
+  rename: {evt: eventType}
+  set: {replayed: "true"}
+  delete: [debug]
+body:
+  rename: {customer_id: customer.id}
+  set:
+    $.version: 2
+    meta: {source: replay}
+  delete: [$.internal]
+`)
+	require.NoError(t, err)
+	received := map[string]*sqs.MessageAttributeValue{}
+	input := transformInput(`{"customer_id":42,"internal":"x","amount":1.50}`, map[string]string{"evt": "created", "debug": "1"})
+	for k, v := range input.MessageAttributes {
+		received[k] = v
+	}
+	input.MessageAttributes = received
+
+	require.NoError(t, transform(context.Background(), input))
+	assert.JSONEq(t, `{"customer":{"id":42},"amount":1.50,"version":2,"meta":{"source":"replay"}}`, aws.StringValue(input.MessageBody))
+	assert.Equal(t, map[string]string{"eventType": "created", "replayed": "true"}, attributeStrings(input.MessageAttributes))
+	assert.Contains(t, received, "debug", "the received attributes are left alone")
+
+	t.Run("numbers keep their precision", func(t *testing.T) {
+		input := transformInput(`{"id":12345678901234567890}`, nil)
+		require.NoError(t, transform(context.Background(), input))
+		assert.Contains(t, aws.StringValue(input.MessageBody), `"id":12345678901234567890`)
+	})
+	t.Run("body rules need a json body", func(t *testing.T) {
+		assert.Error(t, transform(context.Background(), transformInput("plain text", nil)))
+	})
+	t.Run("unknown keys are rejected", func(t *testing.T) {
+		_, err := rulesTransform(t, dir, "bdy: {}\n")
+		assert.Error(t, err)
+	})
+}
+
+func Test_transforming_with_a_template(t *testing.T) {
+	transform, err := newTransform(transformOptions{template: `{"orderId":{{json .Body.order_id}},"type":"{{.Attributes.evt}}"}`})
+	require.NoError(t, err)
+	input := transformInput(`{"order_id":"A1"}`, map[string]string{"evt": "created"})
+	require.NoError(t, transform(context.Background(), input))
+	assert.Equal(t, `{"orderId":"A1","type":"created"}`, aws.StringValue(input.MessageBody))
+}
+
+func Test_transforming_with_a_command(t *testing.T) {
+	transform, err := newTransform(transformOptions{command: `tr a-z A-Z; printf " $AWSQUEUE_ATTR_EVENT_TYPE"`})
+	require.NoError(t, err)
+	input := transformInput("hello", map[string]string{"event-type": "created"})
+	require.NoError(t, transform(context.Background(), input))
+	assert.Equal(t, "HELLO created", aws.StringValue(input.MessageBody))
+
+	failing, err := newTransform(transformOptions{command: "exit 3"})
+	require.NoError(t, err)
+	assert.Error(t, failing(context.Background(), transformInput("hello", nil)))
+}
+
+func Test_no_transform(t *testing.T) {
+	transform, err := newTransform(transformOptions{})
+	require.NoError(t, err)
+	assert.Nil(t, transform)
+}
+
+func Test_previewing_a_transform(t *testing.T) {
+	transform, err := newTransform(transformOptions{template: `{{.Raw}}!`})
+	require.NoError(t, err)
+	input := transformInput("hi", map[string]string{"b": "2", "a": "1"})
+	var buf bytes.Buffer
+	previewTransform(context.Background(), &buf, transform, []string{"m1"}, []*sqs.SendMessageInput{input})
+	assert.Equal(t, ""+
+		"message m1\n"+
+		"- hi\n"+
+		"- attributes: a=1, b=2\n"+
+		"+ hi!\n"+
+		"+ attributes: a=1, b=2\n", buf.String())
+	assert.Equal(t, "hi", aws.StringValue(input.MessageBody), "the preview does not change the input")
+}
@@ -0,0 +1,475 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/NearlyUnique/awsqueue/queue"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+const (
+	KeyUp       = "up"
+	KeyDown     = "down"
+	KeyPageUp   = "pgup"
+	KeyPageDown = "pgdn"
+	KeyEnter    = "enter"
+	KeyEscape   = "esc"
+	KeyBack     = "backspace"
+	KeyCtrlC    = "ctrl-c"
+
+	tuiRefresh = 5 * time.Second
+	// the most messages sampled when a queue is opened
+	tuiSampleSize = 100
+)
+
+type (
+	browseOptions struct {
+		svc        *sqs.SQS
+		list       listQueueOptions
+		visibility int64
+		ctx        context.Context
+	}
+	tui struct {
+		browseOptions
+		queues      []map[string]flexiString
+		queueCursor int
+		queueURL    string
+		messages    []message
+		held        *visibilityManager
+		stopHeld    func()
+		marked      map[int]bool
+		msgCursor   int
+		detailTop   int
+		status      string
+		width       int
+		height      int
+		keys        chan string
+	}
+)
+
+func browse(options browseOptions) error {
+	fd := int(os.Stdin.Fd())
+	if !terminal.IsTerminal(fd) {
+		return errors.New("browse needs an interactive terminal")
+	}
+	state, err := terminal.MakeRaw(fd)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = terminal.Restore(fd, state)
+		fmt.Print("\x1b[?25h\x1b[2J\x1b[H")
+	}()
+	fmt.Print("\x1b[?25l")
+
+	t := &tui{browseOptions: options, keys: readKeys(options.ctx)}
+	refresh := time.NewTicker(tuiRefresh)
+	defer refresh.Stop()
+	t.refreshQueues()
+	for {
+		t.width, t.height, _ = terminal.GetSize(fd)
+		fmt.Print(t.render())
+		select {
+		case <-options.ctx.Done():
+			t.releaseAll()
+			return nil
+		case <-refresh.C:
+			if t.queueURL == "" {
+				t.refreshQueues()
+			}
+		case key, ok := <-t.keys:
+			if !ok || !t.handle(key) {
+				t.releaseAll()
+				return nil
+			}
+		}
+	}
+}
+
+// readKeys decodes stdin into key names, the channel closes when stdin does
+func readKeys(ctx context.Context) chan string {
+	ch := make(chan string)
+	go func() {
+		defer close(ch)
+		buf := make([]byte, 16)
+		for {
+			n, err := os.Stdin.Read(buf)
+			if err != nil {
+				return
+			}
+			select {
+			case ch <- decodeKey(buf[:n]):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch
+}
+
+func decodeKey(buf []byte) string {
+	switch {
+	case bytes.Equal(buf, []byte("\x1b[A")):
+		return KeyUp
+	case bytes.Equal(buf, []byte("\x1b[B")):
+		return KeyDown
+	case bytes.Equal(buf, []byte("\x1b[5~")):
+		return KeyPageUp
+	case bytes.Equal(buf, []byte("\x1b[6~")):
+		return KeyPageDown
+	case bytes.Equal(buf, []byte{0x1b}):
+		return KeyEscape
+	case bytes.Equal(buf, []byte{'\r'}), bytes.Equal(buf, []byte{'\n'}):
+		return KeyEnter
+	case bytes.Equal(buf, []byte{0x7f}), bytes.Equal(buf, []byte{0x08}):
+		return KeyBack
+	case bytes.Equal(buf, []byte{0x03}):
+		return KeyCtrlC
+	}
+	return string(buf)
+}
+
+// handle applies a key press, returning false to quit
+func (t *tui) handle(key string) bool {
+	t.status = ""
+	if key == KeyCtrlC {
+		return false
+	}
+	if t.queueURL == "" {
+		switch key {
+		case "q", KeyEscape:
+			return false
+		case KeyUp, "k":
+			t.queueCursor = clamp(t.queueCursor-1, len(t.queues))
+		case KeyDown, "j":
+			t.queueCursor = clamp(t.queueCursor+1, len(t.queues))
+		case "g":
+			t.refreshQueues()
+		case KeyEnter:
+			if len(t.queues) > 0 {
+				t.openQueue(t.queues[t.queueCursor][queue.AttrKeyQueueUrl].String())
+			}
+		}
+		return true
+	}
+	switch key {
+	case "q", KeyEscape, KeyBack:
+		t.releaseAll()
+		t.queueURL = ""
+		t.refreshQueues()
+	case KeyUp, "k":
+		t.msgCursor = clamp(t.msgCursor-1, len(t.messages))
+		t.detailTop = 0
+	case KeyDown, "j":
+		t.msgCursor = clamp(t.msgCursor+1, len(t.messages))
+		t.detailTop = 0
+	case KeyPageUp, "K":
+		t.detailTop = clamp(t.detailTop-t.detailHeight(), t.detailTop+1)
+	case KeyPageDown, "J":
+		t.detailTop += t.detailHeight()
+	case " ":
+		if len(t.messages) > 0 {
+			t.marked[t.msgCursor] = !t.marked[t.msgCursor]
+		}
+	case "d":
+		t.forSelection("deleted", t.deleteMessage)
+	case "r":
+		t.forSelection("released", t.releaseMessage)
+	case "m":
+		target := t.prompt("move to queue name: ")
+		if target != "" {
+			t.moveSelection(target)
+		}
+	case "e":
+		t.exportSelection()
+	}
+	return true
+}
+
+func (t *tui) refreshQueues() {
+	result, err := listQueues(t.list)
+	if err != nil {
+		t.status = err.Error()
+		return
+	}
+	sort.Slice(result.Attrs, func(i, j int) bool {
+		return result.Attrs[i][queue.AttrKeyQueueName] < result.Attrs[j][queue.AttrKeyQueueName]
+	})
+	t.queues = result.Attrs
+	t.queueCursor = clamp(t.queueCursor, len(t.queues))
+}
+
+// openQueue samples messages, they stay hidden from other consumers until released or the queue is closed
+func (t *tui) openQueue(queueURL string) {
+	t.queueURL = queueURL
+	t.messages = nil
+	t.held = newVisibilityManager(t.svc, queueURL, t.visibility)
+	t.stopHeld = t.held.start(t.ctx)
+	t.marked = make(map[int]bool)
+	t.msgCursor = 0
+	t.detailTop = 0
+	for len(t.messages) < tuiSampleSize {
+		out, err := t.svc.ReceiveMessageWithContext(t.ctx, &sqs.ReceiveMessageInput{
+			QueueUrl:              aws.String(queueURL),
+			AttributeNames:        []*string{aws.String(sqs.QueueAttributeNameAll)},
+			MessageAttributeNames: []*string{aws.String(sqs.QueueAttributeNameAll)},
+			MaxNumberOfMessages:   aws.Int64(10),
+			VisibilityTimeout:     aws.Int64(t.visibility),
+			WaitTimeSeconds:       aws.Int64(0),
+		})
+		if err != nil {
+			t.status = err.Error()
+			return
+		}
+		if len(out.Messages) == 0 {
+			break
+		}
+		messages := queue.SimplifyMessages(out, t.list.location)
+		t.held.hold(messages...)
+		t.messages = append(t.messages, messages...)
+	}
+	t.status = fmt.Sprintf("sampled %d messages, hidden until released", len(t.messages))
+}
+
+// forSelection applies fn to the marked messages, or the current one when none are marked
+func (t *tui) forSelection(verb string, fn func(message) error) {
+	var keep []message
+	done := 0
+	for i, m := range t.messages {
+		if !t.selected(i) {
+			keep = append(keep, m)
+			continue
+		}
+		if err := fn(m); err != nil {
+			t.status = err.Error()
+			keep = append(keep, m)
+			continue
+		}
+		done++
+	}
+	t.messages = keep
+	t.marked = make(map[int]bool)
+	t.msgCursor = clamp(t.msgCursor, len(t.messages))
+	if t.status == "" {
+		t.status = fmt.Sprintf("%s %d messages", verb, done)
+	}
+}
+
+func (t *tui) selected(i int) bool {
+	if !t.anyMarked() {
+		return i == t.msgCursor
+	}
+	return t.marked[i]
+}
+
+func (t *tui) anyMarked() bool {
+	for _, v := range t.marked {
+		if v {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *tui) deleteMessage(m message) error {
+	_, err := t.svc.DeleteMessageWithContext(t.ctx, &sqs.DeleteMessageInput{
+		QueueUrl:      aws.String(t.queueURL),
+		ReceiptHandle: m.Raw.ReceiptHandle,
+	})
+	if err == nil {
+		t.held.forget(m)
+	}
+	return err
+}
+
+func (t *tui) releaseMessage(m message) error {
+	return t.held.release(t.ctx, m)
+}
+
+// releaseAll makes every held message visible again, even after Ctrl-C
+func (t *tui) releaseAll() {
+	if t.stopHeld != nil {
+		t.stopHeld()
+	}
+	t.held = nil
+	t.stopHeld = nil
+	t.messages = nil
+}
+
+// moveSelection sends the original body and attributes to the target, with the FIFO group as move does, then deletes from this queue
+func (t *tui) moveSelection(target string) {
+	out, err := t.svc.GetQueueUrlWithContext(t.ctx, &sqs.GetQueueUrlInput{QueueName: aws.String(target)})
+	if err != nil {
+		t.status = err.Error()
+		return
+	}
+	t.forSelection("moved", func(m message) error {
+		if _, err := t.svc.SendMessageWithContext(t.ctx, moveInput(aws.StringValue(out.QueueUrl), m)); err != nil {
+			return err
+		}
+		return t.deleteMessage(m)
+	})
+}
+
+func (t *tui) exportSelection() {
+	result := readQueueResult{
+		Extracted: queue.FormatTime(time.Now().UTC(), t.list.location),
+		Queue:     t.queueURL,
+	}
+	for i, m := range t.messages {
+		if t.selected(i) {
+			result.Messages = append(result.Messages, m)
+		}
+	}
+	name := fmt.Sprintf("export-%s.json", time.Now().Format("20060102-150405"))
+	buf, err := jsonMarshal(result)
+	if err == nil {
+		err = ioutil.WriteFile(name, buf, 0666)
+	}
+	if err != nil {
+		t.status = err.Error()
+		return
+	}
+	t.status = fmt.Sprintf("exported %d messages to %s", len(result.Messages), name)
+}
+
+// prompt reads a line on the status bar, escape cancels
+func (t *tui) prompt(label string) string {
+	var line []byte
+	for {
+		fmt.Printf("\x1b[%d;1H\x1b[2K%s%s", t.height, label, line)
+		key, ok := <-t.keys
+		if !ok {
+			return ""
+		}
+		switch key {
+		case KeyEnter:
+			return strings.TrimSpace(string(line))
+		case KeyEscape, KeyCtrlC:
+			return ""
+		case KeyBack:
+			if len(line) > 0 {
+				line = line[:len(line)-1]
+			}
+		default:
+			if len(key) == 1 && key[0] >= ' ' {
+				line = append(line, key[0])
+			}
+		}
+	}
+}
+
+func (t *tui) detailHeight() int {
+	return t.height - t.listHeight() - 3
+}
+
+func (t *tui) listHeight() int {
+	return t.height / 3
+}
+
+func (t *tui) render() string {
+	var lines []string
+	if t.queueURL == "" {
+		lines = append(lines, fmt.Sprintf("%7s %7s %7s  %s", "visible", "flight", "delayed", "queue"))
+		top := scrollTop(t.queueCursor, t.height-2)
+		for i := top; i < len(t.queues) && len(lines) < t.height-1; i++ {
+			q := t.queues[i]
+			line := fmt.Sprintf("%7s %7s %7s  %s",
+				q[sqs.QueueAttributeNameApproximateNumberOfMessages],
+				q[sqs.QueueAttributeNameApproximateNumberOfMessagesNotVisible],
+				q[sqs.QueueAttributeNameApproximateNumberOfMessagesDelayed],
+				q[queue.AttrKeyQueueName])
+			lines = append(lines, highlight(truncate(line, t.width), i == t.queueCursor))
+		}
+		return screen(lines, t.height, truncate(statusOr(t.status, "↑↓ select  enter open  g refresh  q quit"), t.width))
+	}
+
+	lines = append(lines, truncate(t.queueURL, t.width))
+	top := scrollTop(t.msgCursor, t.listHeight())
+	for i := top; i < len(t.messages) && i < top+t.listHeight(); i++ {
+		mark := " "
+		if t.marked[i] {
+			mark = "*"
+		}
+		m := t.messages[i]
+		line := fmt.Sprintf("%s %-36s %s", mark, m.MessageId, strings.Join(strings.Fields(m.Message.String()), " "))
+		lines = append(lines, highlight(truncate(line, t.width), i == t.msgCursor))
+	}
+	for len(lines) < t.listHeight()+1 {
+		lines = append(lines, "")
+	}
+	lines = append(lines, strings.Repeat("─", t.width))
+	if len(t.messages) > 0 {
+		buf, _ := jsonMarshal(t.messages[t.msgCursor])
+		detail := strings.Split(string(buf), "\n")
+		if t.detailTop >= len(detail) {
+			t.detailTop = clamp(len(detail)-1, len(detail))
+		}
+		for _, l := range detail[t.detailTop:] {
+			lines = append(lines, truncate(l, t.width))
+		}
+	}
+	help := "space mark  d delete  r release  m move  e export  J/K scroll  q back"
+	return screen(lines, t.height, truncate(statusOr(t.status, help), t.width))
+}
+
+func screen(lines []string, height int, status string) string {
+	var b strings.Builder
+	b.WriteString("\x1b[H\x1b[2J")
+	for i := 0; i < len(lines) && i < height-1; i++ {
+		b.WriteString(lines[i])
+		b.WriteString("\r\n")
+	}
+	b.WriteString(fmt.Sprintf("\x1b[%d;1H\x1b[7m%s\x1b[0m", height, status))
+	return b.String()
+}
+
+func highlight(line string, on bool) string {
+	if on {
+		return "\x1b[7m" + line + "\x1b[0m"
+	}
+	return line
+}
+
+func truncate(line string, width int) string {
+	r := []rune(line)
+	if width <= 0 || len(r) <= width {
+		return line
+	}
+	return string(r[:width])
+}
+
+func statusOr(status, help string) string {
+	if status != "" {
+		return status
+	}
+	return help
+}
+
+// scrollTop keeps the cursor on screen
+func scrollTop(cursor, height int) int {
+	if height < 1 || cursor < height {
+		return 0
+	}
+	return cursor - height + 1
+}
+
+func clamp(i, length int) int {
+	if i >= length {
+		i = length - 1
+	}
+	if i < 0 {
+		i = 0
+	}
+	return i
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/NearlyUnique/awsqueue/queue"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_terminal_keys_are_decoded(t *testing.T) {
+	tests := map[string]string{
+		"\x1b[A":  KeyUp,
+		"\x1b[B":  KeyDown,
+		"\x1b[6~": KeyPageDown,
+		"\x1b":    KeyEscape,
+		"\r":      KeyEnter,
+		"\x7f":    KeyBack,
+		"\x03":    KeyCtrlC,
+		"d":       "d",
+	}
+	for in, expected := range tests {
+		assert.Equal(t, expected, decodeKey([]byte(in)), "%q", in)
+	}
+}
+
+func Test_browser_selection(t *testing.T) {
+	b := &tui{
+		messages: []message{{MessageId: "1"}, {MessageId: "2"}, {MessageId: "3"}},
+		marked:   map[int]bool{},
+	}
+	t.Run("without marks the current message is selected", func(t *testing.T) {
+		b.msgCursor = 1
+
+		assert.False(t, b.selected(0))
+		assert.True(t, b.selected(1))
+	})
+	t.Run("marks replace the current message", func(t *testing.T) {
+		b.handle(" ")
+		b.handle(KeyDown)
+		b.handle(" ")
+		b.handle(" ")
+
+		assert.False(t, b.selected(0))
+		assert.True(t, b.selected(1))
+		assert.False(t, b.selected(2))
+	})
+	t.Run("handled messages leave the list", func(t *testing.T) {
+		b.forSelection("done", func(message) error { return nil })
+
+		assert.Equal(t, []message{{MessageId: "1"}, {MessageId: "3"}}, b.messages)
+		assert.Equal(t, "done 1 messages", b.status)
+	})
+}
+
+func Test_browser_queue_list_is_rendered(t *testing.T) {
+	b := &tui{
+		width:  40,
+		height: 10,
+		queues: []map[string]flexiString{
+			{queue.AttrKeyQueueName: "orders", sqs.QueueAttributeNameApproximateNumberOfMessages: "3"},
+		},
+	}
+
+	screen := b.render()
+
+	assert.Contains(t, screen, "orders")
+	for _, line := range strings.Split(screen, "\r\n") {
+		assert.True(t, len([]rune(stripAnsi(line))) <= b.width, line)
+	}
+}
+
+func Test_scrolling_keeps_the_cursor_visible(t *testing.T) {
+	assert.Equal(t, 0, scrollTop(3, 10))
+	assert.Equal(t, 6, scrollTop(15, 10))
+	assert.Equal(t, 0, clamp(-1, 5))
+	assert.Equal(t, 4, clamp(7, 5))
+}
+
+func stripAnsi(s string) string {
+	var b strings.Builder
+	esc := false
+	for _, r := range s {
+		switch {
+		case r == '\x1b':
+			esc = true
+		case esc && (r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z'):
+			esc = false
+		case !esc:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+// the most entries ChangeMessageVisibilityBatch accepts
+const visibilityBatchSize = 10
+
+type (
+	// visibilityAPI is the part of *sqs.SQS the visibility manager needs
+	visibilityAPI interface {
+		ChangeMessageVisibilityBatchWithContext(aws.Context, *sqs.ChangeMessageVisibilityBatchInput, ...request.Option) (*sqs.ChangeMessageVisibilityBatchOutput, error)
+	}
+	// visibilityManager keeps received messages hidden until they are deleted or released,
+	// a nil manager does nothing so messages simply reappear after their visibility timeout
+	visibilityManager struct {
+		svc      visibilityAPI
+		queueURL string
+		timeout  time.Duration
+		now      func() time.Time
+		mu       sync.Mutex
+		// held is each receipt handle and when it will become visible again
+		held map[string]time.Time
+	}
+)
+
+func newVisibilityManager(svc visibilityAPI, queueURL string, timeoutSeconds int64) *visibilityManager {
+	return &visibilityManager{
+		svc:      svc,
+		queueURL: queueURL,
+		timeout:  time.Duration(timeoutSeconds) * time.Second,
+		now:      time.Now,
+		held:     make(map[string]time.Time),
+	}
+}
+
+// hold starts tracking messages just received with the manager's timeout
+func (v *visibilityManager) hold(messages ...message) {
+	if v == nil {
+		return
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	expires := v.now().Add(v.timeout)
+	for _, m := range messages {
+		if m.Raw != nil && m.Raw.ReceiptHandle != nil {
+			v.held[*m.Raw.ReceiptHandle] = expires
+		}
+	}
+}
+
+// forget stops extending a message, once it is deleted or left to reappear on its own
+func (v *visibilityManager) forget(m message) {
+	if v == nil || m.Raw == nil || m.Raw.ReceiptHandle == nil {
+		return
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	delete(v.held, *m.Raw.ReceiptHandle)
+}
+
+// release makes messages visible again straight away and stops extending them
+func (v *visibilityManager) release(ctx context.Context, messages ...message) error {
+	if v == nil {
+		return nil
+	}
+	var handles []string
+	for _, m := range messages {
+		if m.Raw != nil && m.Raw.ReceiptHandle != nil {
+			handles = append(handles, *m.Raw.ReceiptHandle)
+		}
+	}
+	v.mu.Lock()
+	for _, h := range handles {
+		delete(v.held, h)
+	}
+	v.mu.Unlock()
+	return v.change(ctx, handles, 0)
+}
+
+// releaseAll releases everything still held, it ignores cancellation so it works after Ctrl-C
+func (v *visibilityManager) releaseAll() {
+	if v == nil {
+		return
+	}
+	v.mu.Lock()
+	handles := make([]string, 0, len(v.held))
+	for h := range v.held {
+		handles = append(handles, h)
+	}
+	v.held = make(map[string]time.Time)
+	v.mu.Unlock()
+	if err := v.change(context.Background(), handles, 0); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Error releasing: %v\n", err)
+	}
+}
+
+// extendDue extends every message within half a timeout of becoming visible
+func (v *visibilityManager) extendDue(ctx context.Context) {
+	now := v.now()
+	var due []string
+	v.mu.Lock()
+	for h, expires := range v.held {
+		if expires.Sub(now) <= v.timeout/2 {
+			due = append(due, h)
+			v.held[h] = now.Add(v.timeout)
+		}
+	}
+	v.mu.Unlock()
+	if err := v.change(ctx, due, int64(v.timeout/time.Second)); err != nil && ctx.Err() == nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Error extending visibility: %v\n", err)
+	}
+}
+
+// start extends held messages until ctx is cancelled or stop is called, then releases anything still held
+func (v *visibilityManager) start(ctx context.Context) (stop func()) {
+	if v == nil {
+		return func() {}
+	}
+	interval := v.timeout / 4
+	if interval < 500*time.Millisecond {
+		interval = 500 * time.Millisecond
+	}
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		defer v.releaseAll()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				v.extendDue(ctx)
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+		<-stopped
+	}
+}
+
+// change sends handles in batches, entries that fail are no longer tracked as their handle is likely stale
+func (v *visibilityManager) change(ctx context.Context, handles []string, timeout int64) error {
+	for start := 0; start < len(handles); start += visibilityBatchSize {
+		end := start + visibilityBatchSize
+		if end > len(handles) {
+			end = len(handles)
+		}
+		input := sqs.ChangeMessageVisibilityBatchInput{QueueUrl: aws.String(v.queueURL)}
+		for i, h := range handles[start:end] {
+			input.Entries = append(input.Entries, &sqs.ChangeMessageVisibilityBatchRequestEntry{
+				Id:                aws.String(strconv.Itoa(i)),
+				ReceiptHandle:     aws.String(h),
+				VisibilityTimeout: aws.Int64(timeout),
+			})
+		}
+		out, err := v.svc.ChangeMessageVisibilityBatchWithContext(ctx, &input)
+		if err != nil {
+			return err
+		}
+		for _, failed := range out.Failed {
+			i, _ := strconv.Atoi(aws.StringValue(failed.Id))
+			v.mu.Lock()
+			delete(v.held, handles[start+i])
+			v.mu.Unlock()
+			_, _ = fmt.Fprintf(os.Stderr, "Error changing visibility: %s %s\n", aws.StringValue(failed.Code), aws.StringValue(failed.Message))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeVisibility struct {
+	mu      sync.Mutex
+	batches [][]string
+	timeout []int64
+	// fail makes these receipt handles fail within the batch
+	fail map[string]bool
+	err  error
+}
+
+func (f *fakeVisibility) ChangeMessageVisibilityBatchWithContext(_ aws.Context, input *sqs.ChangeMessageVisibilityBatchInput, _ ...request.Option) (*sqs.ChangeMessageVisibilityBatchOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return nil, f.err
+	}
+	var handles []string
+	out := &sqs.ChangeMessageVisibilityBatchOutput{}
+	for _, e := range input.Entries {
+		handles = append(handles, aws.StringValue(e.ReceiptHandle))
+		if f.fail[aws.StringValue(e.ReceiptHandle)] {
+			out.Failed = append(out.Failed, &sqs.BatchResultErrorEntry{Id: e.Id, Code: aws.String("ReceiptHandleIsInvalid")})
+		}
+	}
+	f.batches = append(f.batches, handles)
+	f.timeout = append(f.timeout, aws.Int64Value(input.Entries[0].VisibilityTimeout))
+	return out, nil
+}
+
+func (f *fakeVisibility) calls() ([][]string, []int64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.batches, f.timeout
+}
+
+func heldMessages(n int) []message {
+	var messages []message
+	for i := 0; i < n; i++ {
+		messages = append(messages, message{Raw: &sqs.Message{ReceiptHandle: aws.String("h" + strconv.Itoa(i))}})
+	}
+	return messages
+}
+
+func sortedHandles(v *visibilityManager) []string {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	var handles []string
+	for h := range v.held {
+		handles = append(handles, h)
+	}
+	sort.Strings(handles)
+	return handles
+}
+
+func Test_extending_visibility_before_it_expires(t *testing.T) {
+	fake := &fakeVisibility{}
+	v := newVisibilityManager(fake, "queue", 60)
+	now := time.Unix(1000, 0)
+	v.now = func() time.Time { return now }
+	messages := heldMessages(12)
+	v.hold(messages...)
+
+	now = now.Add(29 * time.Second)
+	v.extendDue(context.Background())
+	batches, _ := fake.calls()
+	assert.Empty(t, batches, "nothing is due until half the timeout has passed")
+
+	now = now.Add(time.Second)
+	v.forget(messages[0])
+	v.extendDue(context.Background())
+	batches, timeouts := fake.calls()
+	require.Len(t, batches, 2, "at most ten per batch")
+	assert.Equal(t, 11, len(batches[0])+len(batches[1]), "a forgotten message is not extended")
+	assert.Equal(t, []int64{60, 60}, timeouts)
+
+	now = now.Add(10 * time.Second)
+	v.extendDue(context.Background())
+	batches, _ = fake.calls()
+	assert.Len(t, batches, 2, "extended messages are not due again yet")
+}
+
+func Test_releasing_held_messages(t *testing.T) {
+	fake := &fakeVisibility{}
+	v := newVisibilityManager(fake, "queue", 60)
+	messages := heldMessages(3)
+	v.hold(messages...)
+
+	require.NoError(t, v.release(context.Background(), messages[1]))
+	assert.Equal(t, []string{"h0", "h2"}, sortedHandles(v))
+
+	v.releaseAll()
+	batches, timeouts := fake.calls()
+	assert.Empty(t, sortedHandles(v))
+	require.Len(t, batches, 2)
+	assert.Equal(t, []string{"h1"}, batches[0])
+	assert.ElementsMatch(t, []string{"h0", "h2"}, batches[1])
+	assert.Equal(t, []int64{0, 0}, timeouts)
+}
+
+func Test_stale_handles_are_no_longer_extended(t *testing.T) {
+	fake := &fakeVisibility{fail: map[string]bool{"h1": true}}
+	v := newVisibilityManager(fake, "queue", 2)
+	v.hold(heldMessages(3)...)
+	v.now = func() time.Time { return time.Now().Add(time.Hour) }
+	v.extendDue(context.Background())
+	assert.Equal(t, []string{"h0", "h2"}, sortedHandles(v))
+
+	t.Run("a failed call keeps tracking them", func(t *testing.T) {
+		fake.err = errors.New("throttled")
+		v.extendDue(context.Background())
+		assert.Equal(t, []string{"h0", "h2"}, sortedHandles(v))
+	})
+}
+
+func Test_cancelling_releases_everything_held(t *testing.T) {
+	fake := &fakeVisibility{}
+	v := newVisibilityManager(fake, "queue", 60)
+	ctx, cancel := context.WithCancel(context.Background())
+	stop := v.start(ctx)
+	v.hold(heldMessages(2)...)
+	cancel()
+	stop()
+	batches, timeouts := fake.calls()
+	require.Len(t, batches, 1)
+	assert.ElementsMatch(t, []string{"h0", "h1"}, batches[0])
+	assert.Equal(t, []int64{0}, timeouts)
+}
+
+func Test_a_nil_manager_does_nothing(t *testing.T) {
+	var v *visibilityManager
+	v.hold(heldMessages(1)...)
+	v.forget(heldMessages(1)[0])
+	assert.NoError(t, v.release(context.Background(), heldMessages(1)...))
+	v.releaseAll()
+	v.start(context.Background())()
+}